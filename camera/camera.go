@@ -0,0 +1,296 @@
+// Package camera is a client for the HTTP interface exposed by CEYOMUR trail
+// cameras once their WiFi hotspot has been enabled over bluetooth.
+package camera
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// camera commands, passed as ?custom=1&cmd=
+const (
+	CmdMode    = 3001
+	CmdDate    = 3005
+	CmdTime    = 3006
+	CmdList    = 3015
+	CmdBattery = 3019
+	CmdDelete  = 4003
+)
+
+// camera modes, passed with CmdMode
+const (
+	ModePhoto = 0
+	ModeMovie = 1
+)
+
+// camera command status, returned in Function.Status
+const (
+	StatusOK             = "0"
+	StatusNoFile         = "-1"
+	StatusUnknownCommand = "-256"
+)
+
+// File is a single entry in the camera index
+type File struct {
+	XMLName  xml.Name `xml:"File"`
+	Name     string   `xml:"NAME"`
+	FPath    string   `xml:"FPATH"`
+	Size     string   `xml:"SIZE"`
+	Timecode string   `xml:"TIMECODE"`
+	Time     string   `xml:"TIME"`
+	Attr     string   `xml:"ATTR"`
+}
+
+// AllFile is the list of files in the camera index
+type AllFile struct {
+	XMLName xml.Name `xml:"ALLFile"`
+	Files   []File   `xml:"File"`
+}
+
+// List is the camera index returned by CmdList
+type List struct {
+	XMLName xml.Name `xml:"LIST"`
+	Allfile AllFile  `xml:"ALLFile"`
+}
+
+// Function is the reply to a camera command
+type Function struct {
+	XMLName xml.Name `xml:"Function"`
+	Cmd     string   `xml:"Cmd"`
+	Status  string   `xml:"Status"`
+	Value   string   `xml:"Value"`
+}
+
+// Bytes returns the file size listed in the camera index
+func (f File) Bytes() (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(f.Size), 10, 64)
+}
+
+// URLPath converts the camera path (eg A:\DCIM\PHOTO\IM_00001.JPG) into a URL path
+func URLPath(fpath string) string {
+	p := strings.ReplaceAll(fpath, "\\", "/")
+	if i := strings.Index(p, ":"); i >= 0 {
+		p = p[i+1:]
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// Error is returned when a camera command fails
+type Error struct {
+	Op  string
+	URL string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return "unable to " + e.Op + " (" + e.URL + ") - " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError is returned when the camera replies with an unexpected HTTP status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return "unexpected HTTP status " + e.Status
+}
+
+// StatusError is returned when the camera reports that a command failed
+type StatusError struct {
+	Cmd    string
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "command " + e.Cmd + " failed with status " + e.Status
+}
+
+// IsNoFile reports whether err is the camera saying the file does not exist
+func IsNoFile(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Status == StatusNoFile
+}
+
+// SizeError is returned when a download does not match the size in the camera index
+type SizeError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("downloaded %d bytes, expected %d", e.Actual, e.Expected)
+}
+
+// Client talks to a single camera
+//
+// failed downloads are retried Retries times, waiting Backoff before the first
+// retry and doubling the wait each time after
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Retries    int
+	Backoff    time.Duration
+}
+
+// NewClient returns a client for the camera at hostname
+//
+// downloading movies over the camera WiFi can be slow, so the overall timeout
+// is generous while connecting and waiting for headers is not
+func NewClient(hostname string) *Client {
+	return &Client{
+		BaseURL: "http://" + hostname,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+			Transport: &http.Transport{
+				DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+				ResponseHeaderTimeout: 30 * time.Second,
+				IdleConnTimeout:       30 * time.Second,
+			},
+		},
+		Retries: 3,
+		Backoff: 2 * time.Second,
+	}
+}
+
+func (c *Client) commandURL(cmd int, par string, str string) string {
+	url := c.BaseURL + "/?custom=1&cmd=" + strconv.Itoa(cmd)
+	if len(par) > 0 {
+		url = url + "&par=" + par
+	}
+	if len(str) > 0 {
+		url = url + "&str=" + str
+	}
+	return url
+}
+
+// get a url and return the body
+func (c *Client) get(op string, url string) ([]byte, error) {
+	resp, err := c.HTTPClient.Get(url)
+	if err != nil {
+		return nil, &Error{Op: op, URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &Error{Op: op, URL: url, Err: &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &Error{Op: op, URL: url, Err: err}
+	}
+	return body, nil
+}
+
+// run a camera command, parse the reply and check its status
+func (c *Client) command(op string, cmd int, par string, str string) (*Function, error) {
+	url := c.commandURL(cmd, par, str)
+	body, err := c.get(op, url)
+	if err != nil {
+		return nil, err
+	}
+	var function Function
+	err = xml.Unmarshal(body, &function)
+	if err != nil {
+		return nil, &Error{Op: op, URL: url, Err: fmt.Errorf("unable to parse xml - %w", err)}
+	}
+	if function.Status != StatusOK {
+		return &function, &Error{Op: op, URL: url, Err: &StatusError{Cmd: strconv.Itoa(cmd), Status: function.Status}}
+	}
+	return &function, nil
+}
+
+// SetMode switches the camera between photo and movie mode
+func (c *Client) SetMode(mode int) error {
+	_, err := c.command("set mode", CmdMode, strconv.Itoa(mode), "")
+	return err
+}
+
+// SetDate sets the camera date
+func (c *Client) SetDate(t time.Time) error {
+	_, err := c.command("set date", CmdDate, "", t.Format("2006-01-02"))
+	return err
+}
+
+// SetTime sets the camera time of day
+func (c *Client) SetTime(t time.Time) error {
+	_, err := c.command("set time", CmdTime, "", t.Format("15:04:05"))
+	return err
+}
+
+// Battery returns the battery level in percent, over 100 when charging
+func (c *Client) Battery() (int, error) {
+	url := c.commandURL(CmdBattery, "", "")
+	function, err := c.command("get battery", CmdBattery, "", "")
+	if err != nil {
+		return 0, err
+	}
+	battery, err := strconv.Atoi(function.Value)
+	if err != nil {
+		return 0, &Error{Op: "get battery", URL: url, Err: err}
+	}
+	return battery, nil
+}
+
+// index returns the files listed for the current mode
+func (c *Client) index() ([]File, error) {
+	url := c.commandURL(CmdList, "", "")
+	body, err := c.get("list files", url)
+	if err != nil {
+		return nil, err
+	}
+	var list List
+	err = xml.Unmarshal(body, &list)
+	if err != nil {
+		return nil, &Error{Op: "list files", URL: url, Err: fmt.Errorf("unable to parse xml - %w", err)}
+	}
+	return list.Allfile.Files, nil
+}
+
+// List returns photos and movies on the camera sorted by date
+func (c *Client) List() ([]File, error) {
+	var files []File
+
+	for _, mode := range []int{ModePhoto, ModeMovie} {
+		err := c.SetMode(mode)
+		if err != nil {
+			return nil, err
+		}
+		modeFiles, err := c.index()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, modeFiles...)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Timecode < files[j].Timecode
+	})
+
+	return files, nil
+}
+
+// URL returns the download URL for a camera path
+func (c *Client) URL(fpath string) string {
+	return c.BaseURL + URLPath(fpath)
+}
+
+// Delete removes a file from the camera
+func (c *Client) Delete(fpath string) error {
+	_, err := c.command("delete file", CmdDelete, "", fpath)
+	return err
+}
@@ -0,0 +1,207 @@
+package camera_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/plord12/trailcameradownload/camera"
+	"github.com/plord12/trailcameradownload/camera/cameratest"
+)
+
+func TestURLPath(t *testing.T) {
+	if p := camera.URLPath("A:\\DCIM\\PHOTO\\IM_00001.JPG"); p != "/DCIM/PHOTO/IM_00001.JPG" {
+		t.Errorf("unexpected path %s", p)
+	}
+}
+
+func TestList(t *testing.T) {
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	now := time.Date(2022, 12, 5, 23, 43, 40, 0, time.UTC)
+	server.AddMovie("VD_00001.MP4", []byte("movie"), now.Add(time.Minute))
+	server.AddPhoto("IM_00001.JPG", []byte("photo"), now)
+
+	client := camera.NewClient(server.Hostname())
+	files, err := client.List()
+	if err != nil {
+		t.Fatalf("list failed - %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if files[0].Name != "IM_00001.JPG" || files[1].Name != "VD_00001.MP4" {
+		t.Errorf("files not sorted by date - %v", files)
+	}
+	if files[0].Time != "2022/12/05 23:43:40" {
+		t.Errorf("unexpected time %s", files[0].Time)
+	}
+}
+
+func TestDownloadAndDelete(t *testing.T) {
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	file := server.AddPhoto("IM_00001.JPG", []byte("photo data"), time.Now())
+
+	client := camera.NewClient(server.Hostname())
+
+	var buf bytes.Buffer
+	n, err := client.Download(file.FPath, &buf)
+	if err != nil {
+		t.Fatalf("download failed - %v", err)
+	}
+	if n != 10 || buf.String() != "photo data" {
+		t.Errorf("unexpected download %d %q", n, buf.String())
+	}
+
+	err = client.Delete(file.FPath)
+	if err != nil {
+		t.Fatalf("delete failed - %v", err)
+	}
+	if len(server.Files()) != 0 {
+		t.Errorf("file not deleted")
+	}
+	if deleted := server.Deleted(); len(deleted) != 1 || deleted[0] != file.FPath {
+		t.Errorf("unexpected deleted files %v", deleted)
+	}
+}
+
+func TestBattery(t *testing.T) {
+	server := cameratest.NewServer()
+	defer server.Close()
+	server.SetBattery(30)
+
+	client := camera.NewClient(server.Hostname())
+	battery, err := client.Battery()
+	if err != nil {
+		t.Fatalf("battery failed - %v", err)
+	}
+	if battery != 30 {
+		t.Errorf("expected 30%%, got %d%%", battery)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	file := server.AddPhoto("IM_00001.JPG", []byte("photo data"), time.Now())
+
+	client := camera.NewClient(server.Hostname())
+
+	// failed delete must not look like a success
+	server.FailCommand(camera.CmdDelete, "-6")
+	err := client.Delete(file.FPath)
+	var statusErr *camera.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != "-6" {
+		t.Errorf("expected status error, got %v", err)
+	}
+	if len(server.Files()) != 1 {
+		t.Errorf("file deleted")
+	}
+	server.FailCommand(camera.CmdDelete, camera.StatusOK)
+
+	// mode switch failure stops listing
+	server.FailCommand(camera.CmdMode, "-13")
+	_, err = client.List()
+	if !errors.As(err, &statusErr) || statusErr.Cmd != "3001" {
+		t.Errorf("expected status error, got %v", err)
+	}
+	server.FailCommand(camera.CmdMode, camera.StatusOK)
+
+	// deleting a missing file
+	err = client.Delete("A:\\DCIM\\PHOTO\\IM_00099.JPG")
+	if !camera.IsNoFile(err) {
+		t.Errorf("expected no file error, got %v", err)
+	}
+
+	// missing file download
+	var buf bytes.Buffer
+	_, err = client.Download("A:\\DCIM\\PHOTO\\IM_00099.JPG", &buf)
+	var httpErr *camera.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected HTTP error, got %v", err)
+	}
+}
+
+func tempFile(t *testing.T) *os.File {
+	f, err := os.CreateTemp(t.TempDir(), "download.*")
+	if err != nil {
+		t.Fatalf("unable to create temp file - %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func contents(t *testing.T, f *os.File) string {
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("unable to read %s - %v", f.Name(), err)
+	}
+	return string(data)
+}
+
+func TestDownloadSize(t *testing.T) {
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	file := server.AddMovie("VD_00001.MP4", []byte("movie data"), time.Now())
+	server.Truncate(file.FPath, 5)
+
+	client := camera.NewClient(server.Hostname())
+	client.Backoff = time.Millisecond
+
+	_, err := client.DownloadFile(file, tempFile(t))
+	var sizeErr *camera.SizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Expected != 10 || sizeErr.Actual != 5 {
+		t.Errorf("expected size error, got %v", err)
+	}
+
+	server.Truncate(file.FPath, -1)
+	f := tempFile(t)
+	_, err = client.DownloadFile(file, f)
+	if err != nil {
+		t.Errorf("download failed - %v", err)
+	}
+	if contents(t, f) != "movie data" {
+		t.Errorf("unexpected contents %q", contents(t, f))
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+
+	for _, rangeSupport := range []bool{true, false} {
+		server := cameratest.NewServer()
+		server.SetRangeSupport(rangeSupport)
+
+		file := server.AddMovie("VD_00001.MP4", data, time.Now())
+		server.Drop(file.FPath, 40000, 2)
+
+		client := camera.NewClient(server.Hostname())
+		client.Backoff = time.Millisecond
+
+		f := tempFile(t)
+		n, err := client.DownloadFile(file, f)
+		if err != nil {
+			t.Errorf("range %v: download failed - %v", rangeSupport, err)
+		}
+		if n != int64(len(data)) || contents(t, f) != string(data) {
+			t.Errorf("range %v: download corrupt, %d bytes", rangeSupport, n)
+		}
+
+		// give up after retries
+		server.Drop(file.FPath, 1000, client.Retries+1)
+		_, err = client.DownloadFile(file, tempFile(t))
+		if err == nil {
+			t.Errorf("range %v: expected download to fail", rangeSupport)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,278 @@
+// Package cameratest provides a fake trail camera for testing without a real
+// camera on WiFi.
+package cameratest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/plord12/trailcameradownload/camera"
+)
+
+type file struct {
+	info     camera.File
+	mode     int
+	data     []byte
+	time     time.Time
+	truncate int
+	drops    int
+	dropAt   int
+}
+
+// Server is an in-process fake camera
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	mode    int
+	battery int
+	files   map[string]*file
+	deleted []string
+	failing map[int]string
+	noRange bool
+}
+
+// NewServer starts a fake camera with no files and a full battery
+func NewServer() *Server {
+	s := &Server{
+		battery: 100,
+		files:   make(map[string]*file),
+		failing: make(map[int]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Hostname returns the host:port to pass to camera.NewClient
+func (s *Server) Hostname() string {
+	return s.Listener.Addr().String()
+}
+
+// SetBattery sets the level reported by camera.CmdBattery
+func (s *Server) SetBattery(battery int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.battery = battery
+}
+
+// FailCommand makes cmd reply with status, camera.StatusOK restores normal replies
+func (s *Server) FailCommand(cmd int, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == camera.StatusOK {
+		delete(s.failing, cmd)
+	} else {
+		s.failing[cmd] = status
+	}
+}
+
+// AddPhoto adds a file under /DCIM/PHOTO
+func (s *Server) AddPhoto(name string, data []byte, t time.Time) camera.File {
+	return s.add(camera.ModePhoto, "PHOTO", name, data, t)
+}
+
+// AddMovie adds a file under /DCIM/MOVIE
+func (s *Server) AddMovie(name string, data []byte, t time.Time) camera.File {
+	return s.add(camera.ModeMovie, "MOVIE", name, data, t)
+}
+
+func (s *Server) add(mode int, dir string, name string, data []byte, t time.Time) camera.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := &file{
+		info: camera.File{
+			Name:     name,
+			FPath:    "A:\\DCIM\\" + dir + "\\" + name,
+			Size:     strconv.Itoa(len(data)),
+			Timecode: strconv.FormatUint(uint64(timecode(t)), 10),
+			Time:     t.Format("2006/01/02 15:04:05"),
+			Attr:     "32",
+		},
+		mode:     mode,
+		data:     data,
+		time:     t,
+		truncate: -1,
+	}
+	s.files[camera.URLPath(f.info.FPath)] = f
+	return f.info
+}
+
+// Truncate serves only the first n bytes of a file while the index still lists
+// the full size, n < 0 serves the whole file again
+func (s *Server) Truncate(fpath string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[camera.URLPath(fpath)]; ok {
+		f.truncate = n
+	}
+}
+
+// Drop makes the next times downloads of a file fail after n bytes, as if the
+// WiFi link dropped out
+func (s *Server) Drop(fpath string, n int, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[camera.URLPath(fpath)]; ok {
+		f.dropAt = n
+		f.drops = times
+	}
+}
+
+// SetRangeSupport sets whether HTTP range requests are honoured
+func (s *Server) SetRangeSupport(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noRange = !enabled
+}
+
+// Files returns the files still on the camera
+func (s *Server) Files() []camera.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var files []camera.File
+	for _, f := range s.files {
+		files = append(files, f.info)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FPath < files[j].FPath
+	})
+	return files
+}
+
+// Deleted returns the camera paths deleted so far
+func (s *Server) Deleted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.deleted...)
+}
+
+// FAT style date/time, as used by the camera TIMECODE
+func timecode(t time.Time) uint32 {
+	return uint32(t.Year()-1980)<<25 | uint32(t.Month())<<21 | uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" && r.URL.Query().Get("custom") == "1" {
+		s.handleCommand(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	f, ok := s.files[path.Clean(r.URL.Path)]
+	if !ok {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	data := f.data
+	if f.truncate >= 0 && f.truncate < len(data) {
+		data = data[:f.truncate]
+	}
+	if s.noRange {
+		r.Header.Del("Range")
+	}
+	if f.drops > 0 {
+		f.drops--
+		w = &dropWriter{ResponseWriter: w, remaining: f.dropAt}
+	}
+	s.mu.Unlock()
+
+	http.ServeContent(w, r, f.info.Name, f.time, bytes.NewReader(data))
+}
+
+// dropWriter aborts the connection after writing remaining bytes
+type dropWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (d *dropWriter) Write(p []byte) (int, error) {
+	if len(p) > d.remaining {
+		d.ResponseWriter.Write(p[:d.remaining])
+		if flusher, ok := d.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+	d.remaining -= len(p)
+	return d.ResponseWriter.Write(p)
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	cmd, err := strconv.Atoi(query.Get("cmd"))
+	if err != nil {
+		http.Error(w, "bad cmd", http.StatusBadRequest)
+		return
+	}
+	if status, ok := s.failing[cmd]; ok {
+		writeFunction(w, cmd, status, "")
+		return
+	}
+
+	switch cmd {
+	case camera.CmdMode:
+		mode, err := strconv.Atoi(query.Get("par"))
+		if err != nil || (mode != camera.ModePhoto && mode != camera.ModeMovie) {
+			writeFunction(w, cmd, "-1", "")
+			return
+		}
+		s.mode = mode
+		writeFunction(w, cmd, camera.StatusOK, "")
+	case camera.CmdDate, camera.CmdTime:
+		writeFunction(w, cmd, camera.StatusOK, "")
+	case camera.CmdBattery:
+		writeFunction(w, cmd, camera.StatusOK, strconv.Itoa(s.battery))
+	case camera.CmdList:
+		var list camera.List
+		for _, f := range s.files {
+			if f.mode == s.mode {
+				list.Allfile.Files = append(list.Allfile.Files, f.info)
+			}
+		}
+		sort.Slice(list.Allfile.Files, func(i, j int) bool {
+			return list.Allfile.Files[i].Name < list.Allfile.Files[j].Name
+		})
+		writeXML(w, list)
+	case camera.CmdDelete:
+		fpath := query.Get("str")
+		key := camera.URLPath(fpath)
+		if _, ok := s.files[key]; !ok {
+			writeFunction(w, cmd, camera.StatusNoFile, "")
+			return
+		}
+		delete(s.files, key)
+		s.deleted = append(s.deleted, fpath)
+		writeFunction(w, cmd, camera.StatusOK, "")
+	default:
+		writeFunction(w, cmd, camera.StatusUnknownCommand, "")
+	}
+}
+
+func writeFunction(w http.ResponseWriter, cmd int, status string, value string) {
+	writeXML(w, camera.Function{Cmd: strconv.Itoa(cmd), Status: status, Value: value})
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, "%s\n%s\n", xml.Header, body)
+}
@@ -0,0 +1,130 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Download copies a file from the camera to w, returning the number of bytes written
+func (c *Client) Download(fpath string, w io.Writer) (int64, error) {
+	url := c.URL(fpath)
+	resp, err := c.HTTPClient.Get(url)
+	if err != nil {
+		return 0, &Error{Op: "download file", URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, &Error{Op: "download file", URL: url, Err: &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, &Error{Op: "download file", URL: url, Err: err}
+	}
+	return n, nil
+}
+
+// DownloadFile copies a file from the camera to dst and checks the number of bytes
+// written matches the size in the camera index
+//
+// failed downloads are retried with backoff, continuing from where they stopped
+// if the camera supports HTTP range requests and starting again if not
+func (c *Client) DownloadFile(file File, dst io.WriteSeeker) (int64, error) {
+	url := c.URL(file.FPath)
+
+	expected, err := file.Bytes()
+	if err != nil {
+		return 0, &Error{Op: "download file", URL: url, Err: fmt.Errorf("unable to parse size %q - %w", file.Size, err)}
+	}
+
+	var offset int64
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		offset, err = c.downloadFrom(url, dst, offset)
+
+		// camera has nothing more to send, so the file is short on the camera
+		//
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return offset, &Error{Op: "download file", URL: url, Err: &SizeError{Expected: expected, Actual: offset}}
+		}
+		if err == nil && offset != expected {
+			err = &Error{Op: "download file", URL: url, Err: &SizeError{Expected: expected, Actual: offset}}
+		}
+		if err == nil {
+			return offset, nil
+		}
+		if attempt >= c.Retries || !retryable(err) {
+			return offset, err
+		}
+
+		// anything over length can't be continued
+		//
+		var sizeErr *SizeError
+		if errors.As(err, &sizeErr) && sizeErr.Actual > sizeErr.Expected {
+			offset = 0
+		}
+
+		log.Printf("Download failed [%d of %d], retrying from byte %d - %s\n", attempt+1, c.Retries+1, offset, err.Error())
+		time.Sleep(backoff)
+		backoff = backoff * 2
+	}
+}
+
+// download from offset, returning the total bytes now in dst
+func (c *Client) downloadFrom(url string, dst io.WriteSeeker, offset int64) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return offset, &Error{Op: "download file", URL: url, Err: err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return offset, &Error{Op: "download file", URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent &&
+		strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		// carry on where we left off
+	case resp.StatusCode == http.StatusOK:
+		// whole file, so start again
+		offset = 0
+		if t, ok := dst.(interface{ Truncate(int64) error }); ok {
+			err = t.Truncate(0)
+			if err != nil {
+				return 0, &Error{Op: "download file", URL: url, Err: err}
+			}
+		}
+	default:
+		return offset, &Error{Op: "download file", URL: url, Err: &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+
+	_, err = dst.Seek(offset, io.SeekStart)
+	if err != nil {
+		return offset, &Error{Op: "download file", URL: url, Err: err}
+	}
+
+	n, err := io.Copy(dst, resp.Body)
+	if err != nil {
+		return offset + n, &Error{Op: "download file", URL: url, Err: err}
+	}
+	return offset + n, nil
+}
+
+// whether a failed download is worth trying again
+func retryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"log"
+
+	"github.com/mattn/go-tflite"
+	"gocv.io/x/gocv"
+)
+
+var classifierLabels []string = nil
+var classifierModel *tflite.Model = nil
+
+// second stage classifier, run on the box of each detection to refine its
+// label
+type classifier struct {
+	options     *tflite.InterpreterOptions
+	interpreter *tflite.Interpreter
+}
+
+// load the classifier, or unload it if modelPath is empty
+func loadClassifier(modelPath *string, labelPath *string) error {
+
+	var err error
+
+	classifierLabels, classifierModel = nil, nil
+	if len(*modelPath) == 0 {
+		return nil
+	}
+
+	classifierLabels, _, err = loadLabels(*labelPath, false)
+	if err != nil {
+		return err
+	}
+
+	classifierModel = tflite.NewModelFromFile(*modelPath)
+	if classifierModel == nil {
+		return errors.New("cannot load classifier")
+	}
+
+	log.Printf("Loaded classifier %s with %s\n", *modelPath, *labelPath)
+
+	return nil
+}
+
+// new classifier, nil if none is loaded
+func newClassifier() *classifier {
+
+	if classifierModel == nil || classifierLabels == nil {
+		return nil
+	}
+
+	options := tflite.NewInterpreterOptions()
+	options.SetNumThread(4)
+	interpreter := tflite.NewInterpreter(classifierModel, options)
+	if interpreter == nil {
+		log.Printf("cannot create classifier interpreter\n")
+		options.Delete()
+		return nil
+	}
+	if status := interpreter.AllocateTensors(); status != tflite.OK {
+		log.Printf("classifier allocate failed\n")
+		interpreter.Delete()
+		options.Delete()
+		return nil
+	}
+	return &classifier{options: options, interpreter: interpreter}
+}
+
+func (c *classifier) close() {
+	if c == nil {
+		return
+	}
+	c.interpreter.Delete()
+	c.options.Delete()
+}
+
+// label and score for the object in box loc of frame, with a little of its
+// surroundings
+//
+// loc is top, left, bottom, right as for the detector, the score is 0 if it
+// couldn't be classified
+func (c *classifier) classify(frame gocv.Mat, loc []float32) (string, float64) {
+
+	size := frame.Size()
+	width, height := float32(size[1]), float32(size[0])
+	marginX, marginY := (loc[3]-loc[1])*0.1, (loc[2]-loc[0])*0.1
+	box := image.Rect(
+		int(width*(loc[1]-marginX)),
+		int(height*(loc[0]-marginY)),
+		int(width*(loc[3]+marginX)),
+		int(height*(loc[2]+marginY)),
+	).Intersect(image.Rect(0, 0, size[1], size[0]))
+	if box.Empty() {
+		return "", 0
+	}
+
+	crop := frame.Region(box)
+	defer crop.Close()
+	rgb := gocv.NewMat()
+	defer rgb.Close()
+	gocv.CvtColor(crop, &rgb, gocv.ColorBGRToRGB)
+
+	input := c.interpreter.GetInputTensor(0)
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(rgb, &resized, image.Pt(input.Dim(2), input.Dim(1)), 0, 0, gocv.InterpolationDefault)
+	if input.Type() == tflite.Float32 {
+		floats := gocv.NewMat()
+		defer floats.Close()
+		resized.ConvertTo(&floats, gocv.MatTypeCV32F)
+		if ff, err := floats.DataPtrFloat32(); err == nil {
+			for i := 0; i < len(ff); i++ {
+				ff[i] = (ff[i] - 127.5) / 127.5
+			}
+			copy(input.Float32s(), ff)
+		}
+	} else {
+		if v, err := resized.DataPtrUint8(); err == nil {
+			copy(input.UInt8s(), v)
+		}
+	}
+
+	status := c.interpreter.Invoke()
+	if status != tflite.OK {
+		log.Printf("classifier invoke failed %s\n", status.String())
+		return "", 0
+	}
+
+	// highest score, dequantized if needed
+	//
+	output := c.interpreter.GetOutputTensor(0)
+	var scores []float64
+	switch output.Type() {
+	case tflite.Float32:
+		for _, f := range output.Float32s() {
+			scores = append(scores, float64(f))
+		}
+	case tflite.UInt8:
+		qp := output.QuantizationParams()
+		for _, q := range output.UInt8s() {
+			scores = append(scores, qp.Scale*float64(int(q)-qp.ZeroPoint))
+		}
+	default:
+		log.Printf("unsupported classifier output %v\n", output.Type())
+		return "", 0
+	}
+	best := -1
+	for i, score := range scores {
+		if best < 0 || score > scores[best] {
+			best = i
+		}
+	}
+	if best < 0 || best >= len(classifierLabels) {
+		return "", 0
+	}
+	return classifierLabels[best], scores[best]
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"strconv"
+)
+
+// config file settings, keyed by flag name
+//
+// for example :
+//
+//	{
+//	  "signaluser": "+44xxxxxxxxxx",
+//	  "undeletedfiles": true,
+//	  "cameras": [
+//	    { "name": "garden", "address": "D6:30:35:39:28:30", "ssid": "CEYOMUR-2a78.*", "signalgroup": "xxx" },
+//	    { "name": "pond", "address": "D6:30:35:11:22:33", "ssid": "CEYOMUR-9c1d.*", "model": "pond.tflite" }
+//	  ],
+//	  "targets": {
+//	    "family": { "signalgroup": "yyy" }
+//	  },
+//	  "rules": [
+//	    { "labels": [ "Red_Fox", "Common_Hedgehog" ], "targets": [ "family" ] },
+//	    { "labels": [ "Wood_Pigeon" ], "action": "archive" }
+//	  ],
+//	  "thresholds": { "Redwing": 0.75, "Eurasian_Blackbird": 0.75 }
+//	}
+//
+// rules, targets and per label detection thresholds apply to every camera
+type config struct {
+	settings   map[string]interface{}
+	cameras    []cameraProfile
+	rules      []rule
+	targets    map[string]map[string]interface{}
+	thresholds map[string]float64
+}
+
+// settings for one camera, overriding the top level settings
+type cameraProfile struct {
+	name     string
+	settings map[string]interface{}
+}
+
+// flags that can't be set from the config file
+var commandLineOnlyFlags = map[string]bool{"config": true, "camera": true}
+
+// read a JSON config file
+func loadConfig(fileName string) (*config, error) {
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var file map[string]json.RawMessage
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, errors.New("unable to parse " + fileName + " - " + err.Error())
+	}
+
+	c := &config{settings: make(map[string]interface{})}
+	for key, raw := range file {
+		if key == "cameras" {
+			var cameras []map[string]interface{}
+			err = json.Unmarshal(raw, &cameras)
+			if err != nil {
+				return nil, errors.New("unable to parse cameras in " + fileName + " - " + err.Error())
+			}
+			for i, settings := range cameras {
+				name, ok := settings["name"].(string)
+				if !ok || len(name) == 0 {
+					return nil, errors.New("camera " + strconv.Itoa(i+1) + " in " + fileName + " has no name")
+				}
+				delete(settings, "name")
+				c.cameras = append(c.cameras, cameraProfile{name: name, settings: settings})
+			}
+			continue
+		}
+		if key == "rules" {
+			err = json.Unmarshal(raw, &c.rules)
+			if err != nil {
+				return nil, errors.New("unable to parse rules in " + fileName + " - " + err.Error())
+			}
+			continue
+		}
+		if key == "thresholds" {
+			err = json.Unmarshal(raw, &c.thresholds)
+			if err != nil {
+				return nil, errors.New("unable to parse thresholds in " + fileName + " - " + err.Error())
+			}
+			continue
+		}
+		if key == "targets" {
+			err = json.Unmarshal(raw, &c.targets)
+			if err != nil {
+				return nil, errors.New("unable to parse targets in " + fileName + " - " + err.Error())
+			}
+			continue
+		}
+		var value interface{}
+		err = json.Unmarshal(raw, &value)
+		if err != nil {
+			return nil, errors.New("unable to parse " + key + " in " + fileName + " - " + err.Error())
+		}
+		c.settings[key] = value
+	}
+
+	return c, nil
+}
+
+// find a camera profile by name
+func (c *config) camera(name string) (*cameraProfile, error) {
+
+	for i := range c.cameras {
+		if c.cameras[i].name == name {
+			return &c.cameras[i], nil
+		}
+	}
+	return nil, errors.New("camera " + name + " not found in config")
+}
+
+// options for every camera profile, or just the named one
+//
+// opts must be the destination of the flags in fs, flags given on the command
+// line are left alone
+func (c *config) profiles(fs *flag.FlagSet, name string, opts *options) ([]options, error) {
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if len(c.cameras) == 0 || len(name) > 0 {
+		err := c.apply(fs, name, explicit)
+		if err != nil {
+			return nil, err
+		}
+		return []options{*opts}, nil
+	}
+
+	var all []options
+	for _, profile := range c.cameras {
+		err := c.apply(fs, profile.name, explicit)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, *opts)
+	}
+	return all, nil
+}
+
+// set flags from the config file and a camera profile, the first camera if
+// name is empty
+//
+// explicit flags are left alone, others start from their defaults so nothing
+// is left over from a previous profile
+func (c *config) apply(fs *flag.FlagSet, name string, explicit map[string]bool) error {
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !explicit[f.Name] {
+			f.Value.Set(f.DefValue)
+		}
+	})
+
+	err := setFlags(fs, c.settings, explicit)
+	if err != nil {
+		return err
+	}
+
+	if len(c.cameras) == 0 {
+		if len(name) > 0 {
+			return errors.New("camera " + name + " not found in config")
+		}
+		return nil
+	}
+
+	profile := &c.cameras[0]
+	if len(name) > 0 {
+		profile, err = c.camera(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// profile name is the camera name in alerts
+	//
+	if fs.Lookup("name") != nil && !explicit["name"] {
+		fs.Set("name", profile.name)
+	}
+
+	return setFlags(fs, profile.settings, explicit)
+}
+
+func setFlags(fs *flag.FlagSet, settings map[string]interface{}, explicit map[string]bool) error {
+
+	for key, value := range settings {
+		if fs.Lookup(key) == nil || commandLineOnlyFlags[key] {
+			return errors.New("unknown setting " + key)
+		}
+		if explicit[key] {
+			continue
+		}
+
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case bool:
+			s = strconv.FormatBool(v)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return errors.New("unsupported value for " + key)
+		}
+
+		err := fs.Set(key, s)
+		if err != nil {
+			return errors.New("invalid value for " + key + " - " + err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configPath, []byte(`{
+		"signaluser": "+440000000000",
+		"limits": 3,
+		"savejpg": true,
+		"cameras": [
+			{ "name": "garden", "address": "D6:30:35:39:28:30", "ssid": "CEYOMUR-garden" },
+			{ "name": "pond", "address": "D6:30:35:11:22:33", "model": "pond.tflite" }
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config - %v", err)
+	}
+
+	newFlags := func() (*flag.FlagSet, *options) {
+		opts := &options{}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.StringVar(&opts.name, "name", "", "")
+		fs.StringVar(&opts.address, "address", "D6:30:35:.*", "")
+		fs.StringVar(&opts.ssid, "ssid", "CEYOMUR-.*", "")
+		fs.StringVar(&opts.modelPath, "model", "detect.tflite", "")
+		fs.StringVar(&opts.signalUser, "signaluser", "", "")
+		fs.IntVar(&opts.limits, "limits", 5, "")
+		fs.BoolVar(&opts.savejpg, "savejpg", false, "")
+		fs.String("camera", "", "")
+		return fs, opts
+	}
+
+	// command line wins over the config file
+	fs, opts := newFlags()
+	err = fs.Parse([]string{"-ssid", "CEYOMUR-override"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cameras, err := config.profiles(fs, "", opts)
+	if err != nil {
+		t.Fatalf("failed to apply config - %v", err)
+	}
+	if len(cameras) != 2 {
+		t.Fatalf("expected 2 cameras, got %d", len(cameras))
+	}
+
+	garden, pond := cameras[0], cameras[1]
+	if garden.name != "garden" || garden.address != "D6:30:35:39:28:30" || garden.modelPath != "detect.tflite" {
+		t.Errorf("garden profile not applied - %+v", garden)
+	}
+	if pond.name != "pond" || pond.address != "D6:30:35:11:22:33" || pond.modelPath != "pond.tflite" {
+		t.Errorf("pond profile not applied - %+v", pond)
+	}
+	for _, camera := range cameras {
+		if camera.ssid != "CEYOMUR-override" {
+			t.Errorf("%s: command line overridden - %s", camera.name, camera.ssid)
+		}
+		if camera.signalUser != "+440000000000" || camera.limits != 3 || !camera.savejpg {
+			t.Errorf("%s: top level settings not applied - %+v", camera.name, camera)
+		}
+	}
+
+	// single named camera
+	fs, opts = newFlags()
+	cameras, err = config.profiles(fs, "pond", opts)
+	if err != nil || len(cameras) != 1 || cameras[0].name != "pond" {
+		t.Errorf("expected only pond camera - %v %+v", err, cameras)
+	}
+
+	fs, opts = newFlags()
+	if _, err = config.profiles(fs, "shed", opts); err == nil {
+		t.Errorf("expected missing camera error")
+	}
+}
+
+func TestConfigRules(t *testing.T) {
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configPath, []byte(`{
+		"targets": { "family": { "signalgroup": "family" } },
+		"rules": [
+			{ "labels": [ "Red_Fox" ], "minscore": 0.2, "targets": [ "family" ], "priority": "high" },
+			{ "nothing": true, "action": "drop" }
+		],
+		"thresholds": { "Redwing": 0.75 }
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config - %v", err)
+	}
+	if len(config.rules) != 2 || config.rules[0].MinScore != 0.2 || !config.rules[1].Nothing || config.rules[1].Action != actionDrop {
+		t.Errorf("unexpected rules %+v", config.rules)
+	}
+	if config.targets["family"]["signalgroup"] != "family" || len(config.settings) != 0 {
+		t.Errorf("unexpected targets %v", config.targets)
+	}
+	if len(config.thresholds) != 1 || config.thresholds["Redwing"] != 0.75 {
+		t.Errorf("unexpected thresholds %v", config.thresholds)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// parse the daemon schedule, a cron expression if given otherwise a fixed interval
+func parseSchedule(interval time.Duration, schedule string) (cron.Schedule, error) {
+
+	if len(schedule) > 0 {
+		s, err := cron.ParseStandard(schedule)
+		if err != nil {
+			return nil, errors.New("unable to parse schedule - " + err.Error())
+		}
+		return s, nil
+	}
+	if interval < time.Second {
+		return nil, errors.New("interval must be at least one second")
+	}
+	return cron.Every(interval), nil
+}
+
+// keep running, downloading on a schedule until ctx is done
+//
+// the model stays loaded and bluetooth enabled between runs
+func runDaemon(ctx context.Context, cameras []options, interval time.Duration, schedule string) error {
+
+	s, err := parseSchedule(interval, schedule)
+	if err != nil {
+		return err
+	}
+
+	// with a fixed interval, start straight away
+	//
+	next := time.Now()
+	if len(schedule) > 0 {
+		next = s.Next(next)
+	}
+
+	for {
+		log.Printf("Next download at %s\n", next.Format("2006-01-02 15:04:05"))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("Stopping")
+			return nil
+		case <-timer.C:
+		}
+
+		err = run(ctx, cameras)
+		if err != nil {
+			log.Println(err.Error())
+		}
+
+		if ctx.Err() != nil {
+			log.Println("Stopping")
+			return nil
+		}
+
+		next = s.Next(time.Now())
+	}
+}
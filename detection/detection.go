@@ -0,0 +1,128 @@
+// Package detection describes the objects found in a camera file.
+package detection
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultCutoff is the average score a label needs to be described
+const DefaultCutoff = 0.05
+
+// Box is a bounding box, as fractions of the frame width and height
+type Box struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+}
+
+// Detection is a single object found in a frame
+type Detection struct {
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+	Box   Box     `json:"box"`
+	Frame int     `json:"frame"`
+}
+
+// Label is the score for one label across a file, with the most objects seen
+// at once and, for videos, the seconds any were visible
+type Label struct {
+	Name    string  `json:"label"`
+	Score   float64 `json:"score"`
+	Count   int     `json:"count,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// Result is the outcome of object detection on a file
+//
+// Preview, if set, is a short animation of the frames of a video with
+// detections, Still the annotated frame with the highest score and Trimmed
+// the input video cut down to the parts with detections
+type Result struct {
+	Output      string
+	Preview     string
+	Still       string
+	Trimmed     string
+	Description string
+	Labels      []Label
+	Detections  []Detection
+	Tracks      []Track
+	Frames      int
+}
+
+// Names returns the label names, highest score first
+func (r *Result) Names() []string {
+	names := make([]string, 0, len(r.Labels))
+	for _, label := range r.Labels {
+		names = append(names, label.Name)
+	}
+	return names
+}
+
+// Best returns the highest scoring detection for each label, in label order
+func (r *Result) Best() []Detection {
+	best := make(map[string]Detection)
+	for _, d := range r.Detections {
+		if b, ok := best[d.Label]; !ok || d.Score > b.Score {
+			best[d.Label] = d
+		}
+	}
+	var detections []Detection
+	for _, label := range r.Labels {
+		if d, ok := best[label.Name]; ok {
+			detections = append(detections, d)
+		}
+	}
+	return detections
+}
+
+// Describe lists the labels scoring more than cutoff, with the first in bold,
+// such as " 2 × 𝐑𝐞𝐝 𝐅𝐨𝐱 (85.0%, visible 12s)"
+func Describe(labels []Label, cutoff float64) string {
+
+	description := ""
+	first := true
+	for _, label := range labels {
+		if label.Score > cutoff {
+			name := strings.Replace(label.Name, "_", " ", -1)
+			if first {
+				name = bold(name)
+			}
+			if label.Count > 1 {
+				name = fmt.Sprintf("%d × %s", label.Count, name)
+			}
+			if label.Seconds > 0 {
+				visible := time.Duration(label.Seconds * float64(time.Second))
+				if visible < time.Second {
+					visible = visible.Round(100 * time.Millisecond)
+				} else {
+					visible = visible.Round(time.Second)
+				}
+				description = fmt.Sprintf("%s %s (%0.1f%%, visible %s)", description, name, label.Score*100, visible)
+			} else {
+				description = fmt.Sprintf("%s %s (%0.1f%%)", description, name, label.Score*100)
+			}
+			first = false
+		}
+	}
+	return description
+}
+
+func bold(original string) string {
+
+	makeBold := func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + '𝐀'
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + '𝐚'
+		case r >= '0' && r <= '9':
+			return r - '0' + '𝟎'
+		}
+
+		return r
+	}
+	return strings.Map(makeBold, original)
+}
@@ -0,0 +1,159 @@
+package detection
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	detections := []Detection{
+		{Label: "Red_Fox", Score: 0.9},
+		{Label: "Red_Fox", Score: 0.8, Frame: 1},
+		{Label: "Domestic_Cat", Score: 0.7, Frame: 1},
+		{Label: "Person", Score: 0.1, Frame: 2},
+	}
+	labels := []Label{{Name: "Red_Fox", Score: 0.85, Count: 2, Seconds: 12.4}, {Name: "Domestic_Cat", Score: 0.7, Seconds: 0.43}, {Name: "Person", Score: 0.01}}
+
+	description := Describe(labels, 0.05)
+	if description != " 2 × 𝐑𝐞𝐝 𝐅𝐨𝐱 (85.0%, visible 12s) Domestic Cat (70.0%, visible 400ms)" {
+		t.Errorf("unexpected description %q", description)
+	}
+	if description := Describe([]Label{{Name: "Wood_Pigeon", Score: 0.9}}, 0.05); description != " 𝐖𝐨𝐨𝐝 𝐏𝐢𝐠𝐞𝐨𝐧 (90.0%)" {
+		t.Errorf("unexpected image description %q", description)
+	}
+
+	best := (&Result{Labels: labels, Detections: detections}).Best()
+	if len(best) != 3 || best[0].Score != 0.9 || best[1].Label != "Domestic_Cat" {
+		t.Errorf("unexpected best detections %v", best)
+	}
+}
+
+func TestTracks(t *testing.T) {
+
+	// two foxes crossing at 10fps, one briefly labelled a cat, and a one frame
+	// flicker of a person
+	//
+	var detections []Detection
+	for frame := 0; frame < 20; frame++ {
+		x := float64(frame) * 0.02
+		label := "Red_Fox"
+		if frame == 5 {
+			label = "Domestic_Cat"
+		}
+		detections = append(detections, Detection{Label: label, Score: 0.8, Frame: frame, Box: Box{Left: x, Top: 0.1, Right: x + 0.2, Bottom: 0.3}})
+		if frame >= 10 && frame != 14 {
+			detections = append(detections, Detection{Label: "Red_Fox", Score: 0.6, Frame: frame, Box: Box{Left: 0.8 - x, Top: 0.6, Right: 1 - x, Bottom: 0.8}})
+		}
+	}
+	detections = append(detections, Detection{Label: "Person", Score: 0.9, Frame: 7, Box: Box{Left: 0.5, Top: 0.5, Right: 0.6, Bottom: 0.6}})
+
+	tracks := DefaultTracking.Tracks(detections, 30, 10)
+	if len(tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got %+v", tracks)
+	}
+	if tracks[0].Label != "Red_Fox" || tracks[0].First != 0 || tracks[0].Last != 19 || tracks[0].Detections != 20 {
+		t.Errorf("unexpected first track %+v", tracks[0])
+	}
+	if tracks[0].Score < 0.759 || tracks[0].Score > 0.761 {
+		t.Errorf("expected the cat flicker to lower the score, got %f", tracks[0].Score)
+	}
+	if tracks[1].First != 10 || tracks[1].Detections != 9 {
+		t.Errorf("expected second track across the missed frame, got %+v", tracks[1])
+	}
+
+	labels := Summarise(tracks, 30, 10)
+	if !reflect.DeepEqual(labels, []Label{{Name: "Red_Fox", Score: tracks[0].Score, Count: 2, Seconds: 2}}) {
+		t.Errorf("unexpected labels %+v", labels)
+	}
+
+	// every box counts in an image
+	//
+	image := []Detection{{Label: "House_Sparrow", Score: 0.7}, {Label: "House_Sparrow", Score: 0.8, Box: Box{Left: 0.5, Right: 0.6, Bottom: 0.1}}, {Label: "Blue_Tit", Score: 0.65}}
+	labels = Summarise(DefaultTracking.Tracks(image, 1, 0), 1, 0)
+	if !reflect.DeepEqual(labels, []Label{{Name: "House_Sparrow", Score: 0.8, Count: 2}, {Name: "Blue_Tit", Score: 0.65, Count: 1}}) {
+		t.Errorf("unexpected image labels %+v", labels)
+	}
+
+	if box := (Box{Left: 0, Top: 0, Right: 0.2, Bottom: 0.2}); box.IoU(Box{Left: 0.1, Top: 0, Right: 0.3, Bottom: 0.2}) < 0.333 || box.IoU(Box{Left: 0.5, Right: 0.6, Bottom: 0.1}) != 0 {
+		t.Errorf("unexpected IoU")
+	}
+}
+
+func TestSegments(t *testing.T) {
+	detections := []Detection{
+		{Label: "Red_Fox", Frame: 12},
+		{Label: "Domestic_Cat", Frame: 12},
+		{Label: "Red_Fox", Frame: 3},
+		{Label: "Red_Fox", Frame: 18},
+		{Label: "Red_Fox", Frame: 60},
+		{Label: "Red_Fox", Frame: 98},
+	}
+
+	// 10fps padded 0.5s, frames 3, 12 and 18 overlap once padded
+	//
+	segments := Segments(detections, 100, 10, 500*time.Millisecond)
+	expected := []Segment{{Start: 0, End: 24}, {Start: 55, End: 66}, {Start: 93, End: 100}}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("unexpected segments %v", segments)
+	}
+
+	if segments := Segments(detections, 100, 10, 0); len(segments) != 5 || segments[0] != (Segment{Start: 3, End: 4}) {
+		t.Errorf("unexpected unpadded segments %v", segments)
+	}
+	if segments := Segments(nil, 100, 10, time.Second); segments != nil {
+		t.Errorf("expected no segments, got %v", segments)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	for _, test := range []struct {
+		line      string
+		label     string
+		threshold float64
+	}{
+		{"Wood_Pigeon", "Wood_Pigeon", 0},
+		{"Redwing 0.75", "Redwing", 0.75},
+		{"Eurasian_Blackbird\t0.8 ", "Eurasian_Blackbird", 0.8},
+		{"Long-tailed_Tit 2", "Long-tailed_Tit 2", 0},
+		{"???", "???", 0},
+	} {
+		label, threshold := ParseLabel(test.line)
+		if label != test.label || threshold != test.threshold {
+			t.Errorf("%q: unexpected %q %f", test.line, label, threshold)
+		}
+	}
+
+	thresholds := Thresholds{Default: DefaultThreshold, Labels: map[string]float64{"Redwing": 0.75}}
+	if thresholds.For("Redwing") != 0.75 || thresholds.For("Wood_Pigeon") != DefaultThreshold {
+		t.Errorf("unexpected thresholds")
+	}
+	thresholds.Default = 0.5
+	if thresholds.For("Wood_Pigeon") != 0.5 {
+		t.Errorf("unexpected default threshold")
+	}
+	thresholds.Default = 0
+	if thresholds.For("Wood_Pigeon") != 0 || thresholds.For("Redwing") != 0.75 {
+		t.Errorf("expected every box to count")
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	bird := Box{Left: 0.1, Top: 0.1, Right: 0.3, Bottom: 0.3}
+	detections := []Detection{
+		{Label: "Blue_Tit", Score: 0.7, Box: bird},
+		{Label: "Great_Tit", Score: 0.8, Box: Box{Left: 0.11, Top: 0.1, Right: 0.31, Bottom: 0.3}},
+		{Label: "Great_Tit", Score: 0.75, Box: Box{Left: 0.12, Top: 0.1, Right: 0.32, Bottom: 0.31}},
+		{Label: "Great_Tit", Score: 0.65, Box: Box{Left: 0.6, Top: 0.6, Right: 0.8, Bottom: 0.8}},
+	}
+
+	if kept := DefaultSuppression.Keep(detections); !reflect.DeepEqual(kept, []int{1, 0, 3}) {
+		t.Errorf("unexpected per label suppression %v", kept)
+	}
+	if kept := (Suppression{LabelIoU: 0.5, AnyIoU: 0.5}).Keep(detections); !reflect.DeepEqual(kept, []int{1, 3}) {
+		t.Errorf("unexpected suppression of any label %v", kept)
+	}
+	if kept := (Suppression{}).Keep(detections); len(kept) != 4 {
+		t.Errorf("expected no suppression, got %v", kept)
+	}
+}
@@ -0,0 +1,51 @@
+package detection
+
+import (
+	"sort"
+	"time"
+)
+
+// Segment is a run of video frames, from Start up to but not including End
+type Segment struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Segments returns the parts of a video of frames frames at fps with
+// detections, each padded either side and overlapping ones merged
+func Segments(detections []Detection, frames int, fps float64, padding time.Duration) []Segment {
+
+	if len(detections) == 0 || frames == 0 {
+		return nil
+	}
+	pad := int(padding.Seconds()*fps + 0.5)
+
+	seen := make(map[int]bool)
+	var detected []int
+	for _, d := range detections {
+		if !seen[d.Frame] {
+			seen[d.Frame] = true
+			detected = append(detected, d.Frame)
+		}
+	}
+	sort.Ints(detected)
+
+	var segments []Segment
+	for _, frame := range detected {
+		start, end := frame-pad, frame+pad+1
+		if start < 0 {
+			start = 0
+		}
+		if end > frames {
+			end = frames
+		}
+		if n := len(segments); n > 0 && start <= segments[n-1].End {
+			if end > segments[n-1].End {
+				segments[n-1].End = end
+			}
+			continue
+		}
+		segments = append(segments, Segment{Start: start, End: end})
+	}
+	return segments
+}
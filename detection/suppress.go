@@ -0,0 +1,50 @@
+package detection
+
+import "sort"
+
+// Suppression removes boxes overlapping a higher scoring one, non-maximum
+// suppression
+//
+// boxes with the same label overlapping by more than LabelIoU are suppressed,
+// as are boxes of any label overlapping by more than AnyIoU, such as one bird
+// labelled both Great_Tit and Blue_Tit.  Zero disables either
+type Suppression struct {
+	LabelIoU float64
+	AnyIoU   float64
+}
+
+// DefaultSuppression only suppresses boxes of the same label
+var DefaultSuppression = Suppression{LabelIoU: 0.5}
+
+// Keep returns the indexes of the detections in one frame to keep, highest
+// score first
+func (s Suppression) Keep(detections []Detection) []int {
+
+	order := make([]int, len(detections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return detections[order[i]].Score > detections[order[j]].Score
+	})
+
+	var kept []int
+	for _, i := range order {
+		suppressed := false
+		for _, k := range kept {
+			iou := detections[i].Box.IoU(detections[k].Box)
+			if s.AnyIoU > 0 && iou > s.AnyIoU {
+				suppressed = true
+				break
+			}
+			if s.LabelIoU > 0 && iou > s.LabelIoU && detections[i].Label == detections[k].Label {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,41 @@
+package detection
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultThreshold is the score a box needs to count as a detection
+const DefaultThreshold = 0.6
+
+// Thresholds are the scores boxes need to count as detections, Labels
+// overriding Default for some labels
+//
+// a Default of 0 counts every box, DefaultThreshold is the usual one
+type Thresholds struct {
+	Default float64
+	Labels  map[string]float64
+}
+
+// For returns the threshold for label
+func (t Thresholds) For(label string) float64 {
+	if threshold, ok := t.Labels[label]; ok {
+		return threshold
+	}
+	return t.Default
+}
+
+// ParseLabel splits a label file line into the label and its threshold, if
+// the line ends with one such as "Redwing 0.75", otherwise 0
+func ParseLabel(line string) (string, float64) {
+	line = strings.TrimSpace(line)
+	i := strings.LastIndexAny(line, " \t")
+	if i < 0 {
+		return line, 0
+	}
+	threshold, err := strconv.ParseFloat(line[i+1:], 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		return line, 0
+	}
+	return strings.TrimSpace(line[:i]), threshold
+}
@@ -0,0 +1,222 @@
+package detection
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Track is one object followed across the frames of a video, labelled with
+// the label scoring most over its detections
+//
+// Score is the mean score of that label over all the track's detections, so
+// flickers to other labels lower it
+type Track struct {
+	Label      string  `json:"label"`
+	Score      float64 `json:"score"`
+	First      int     `json:"first"`
+	Last       int     `json:"last"`
+	Detections int     `json:"detections"`
+	Box        Box     `json:"box"`
+
+	scores map[string]float64
+}
+
+// Tracking matches detections in one frame to those in earlier frames
+//
+// boxes overlapping by at least MinIoU are the same object, otherwise the
+// nearest with centres within MaxDistance box sizes.  Objects can be missed
+// for up to MaxGap, tracks with fewer than MinDetections are dropped as
+// flickers
+type Tracking struct {
+	MinIoU        float64
+	MaxDistance   float64
+	MaxGap        time.Duration
+	MinDetections int
+}
+
+// DefaultTracking suits animals moving across a trail camera at 30fps
+var DefaultTracking = Tracking{MinIoU: 0.3, MaxDistance: 0.5, MaxGap: time.Second, MinDetections: 3}
+
+// Area of the box
+func (b Box) Area() float64 {
+	if b.Right <= b.Left || b.Bottom <= b.Top {
+		return 0
+	}
+	return (b.Right - b.Left) * (b.Bottom - b.Top)
+}
+
+// IoU is the intersection over union of two boxes
+func (b Box) IoU(other Box) float64 {
+	intersection := Box{
+		Left:   math.Max(b.Left, other.Left),
+		Top:    math.Max(b.Top, other.Top),
+		Right:  math.Min(b.Right, other.Right),
+		Bottom: math.Min(b.Bottom, other.Bottom),
+	}.Area()
+	union := b.Area() + other.Area() - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
+
+// distance between box centres in box sizes
+func (b Box) distance(other Box) float64 {
+	size := (b.Right - b.Left + b.Bottom - b.Top) / 2
+	if size <= 0 {
+		return math.Inf(1)
+	}
+	return math.Hypot((b.Left+b.Right-other.Left-other.Right)/2, (b.Top+b.Bottom-other.Top-other.Bottom)/2) / size
+}
+
+// Tracks follows the objects in the detections of a video of frames frames at
+// fps, in order of first appearance
+func (t Tracking) Tracks(detections []Detection, frames int, fps float64) []Track {
+
+	sorted := append([]Detection(nil), detections...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Frame < sorted[j].Frame
+	})
+	maxGap := int(t.MaxGap.Seconds() * fps)
+	if maxGap < 1 {
+		maxGap = 1
+	}
+
+	var tracks []*Track
+	for start := 0; start < len(sorted); {
+		frame := sorted[start].Frame
+		end := start
+		for end < len(sorted) && sorted[end].Frame == frame {
+			end++
+		}
+		current := sorted[start:end]
+		start = end
+
+		// best matches first, by overlap then distance
+		//
+		type match struct {
+			track, detection int
+			value            float64
+		}
+		var matches []match
+		for i, track := range tracks {
+			if track.Last == frame || frame-track.Last > maxGap {
+				continue
+			}
+			for j, d := range current {
+				if iou := track.Box.IoU(d.Box); iou >= t.MinIoU {
+					matches = append(matches, match{i, j, 1 + iou})
+				} else if distance := track.Box.distance(d.Box); distance <= t.MaxDistance {
+					matches = append(matches, match{i, j, 1 - distance/t.MaxDistance})
+				}
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].value > matches[j].value
+		})
+
+		matched := make(map[int]bool)
+		for _, m := range matches {
+			track := tracks[m.track]
+			if matched[m.detection] || track.Last == frame {
+				continue
+			}
+			matched[m.detection] = true
+			track.add(current[m.detection])
+		}
+		for j, d := range current {
+			if !matched[j] {
+				track := &Track{First: frame, scores: make(map[string]float64)}
+				track.add(d)
+				tracks = append(tracks, track)
+			}
+		}
+	}
+
+	minDetections := t.MinDetections
+	if minDetections > frames {
+		minDetections = frames
+	}
+	var found []Track
+	for _, track := range tracks {
+		if track.Detections < minDetections {
+			continue
+		}
+		for label, score := range track.scores {
+			if score > track.Score || (score == track.Score && label < track.Label) {
+				track.Label, track.Score = label, score
+			}
+		}
+		track.Score /= float64(track.Detections)
+		found = append(found, *track)
+	}
+	return found
+}
+
+func (t *Track) add(d Detection) {
+	t.Last = d.Frame
+	t.Box = d.Box
+	t.Detections++
+	t.scores[d.Label] += d.Score
+}
+
+// Summarise tracks by label, highest scoring first
+//
+// each label scores as its best track, with the most tracks seen at once and,
+// for videos, the time any were visible
+func Summarise(tracks []Track, frames int, fps float64) []Label {
+
+	byLabel := make(map[string][]Track)
+	for _, track := range tracks {
+		byLabel[track.Label] = append(byLabel[track.Label], track)
+	}
+
+	labels := make([]Label, 0, len(byLabel))
+	for name, tracks := range byLabel {
+		label := Label{Name: name}
+
+		// sweep the frames each track starts and ends
+		//
+		type event struct {
+			frame, change int
+		}
+		var events []event
+		for _, track := range tracks {
+			label.Score = math.Max(label.Score, track.Score)
+			events = append(events, event{track.First, 1}, event{track.Last + 1, -1})
+		}
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].frame == events[j].frame {
+				return events[i].change < events[j].change
+			}
+			return events[i].frame < events[j].frame
+		})
+		visible, since := 0, 0
+		count := 0
+		for _, e := range events {
+			if count == 0 {
+				since = e.frame
+			}
+			count += e.change
+			if count > label.Count {
+				label.Count = count
+			}
+			if count == 0 {
+				visible += e.frame - since
+			}
+		}
+		if frames > 1 && fps > 0 {
+			label.Seconds = float64(visible) / fps
+		}
+		labels = append(labels, label)
+	}
+
+	sort.SliceStable(labels, func(i, j int) bool {
+		if labels[i].Score == labels[j].Score {
+			return labels[i].Name < labels[j].Name
+		}
+		return labels[i].Score > labels[j].Score
+	})
+	return labels
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/plord12/trailcameradownload/montage"
+	"github.com/plord12/trailcameradownload/notify"
+)
+
+// digest collects the pictures for each notifier during a run, to report them
+// in a single message
+//
+// pictures are deleted from the camera only once their digest is sent
+type digest struct {
+	top    int
+	sheet  bool
+	cutoff float64
+
+	mu     sync.Mutex
+	groups []*digestGroup
+}
+
+// pictures for one notifier, from the rule that routed them
+type digestGroup struct {
+	rule     int
+	notifier notify.Notifier
+	pictures []Picture
+}
+
+// new digest attaching the top most confident pictures, after a contact sheet
+// of them all if sheet is set, counting labels scoring over cutoff
+func newDigest(top int, sheet bool, cutoff float64) *digest {
+	return &digest{top: top, sheet: sheet, cutoff: cutoff}
+}
+
+func (d *digest) add(to route, picture Picture) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, group := range d.groups {
+		if group.rule == to.rule {
+			group.pictures = append(group.pictures, picture)
+			return
+		}
+	}
+	d.groups = append(d.groups, &digestGroup{rule: to.rule, notifier: to.notifier, pictures: []Picture{picture}})
+}
+
+// send each digest, removing its pictures from the camera once sent
+func (d *digest) send(remove func(picture *Picture) error) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	groups := d.groups
+	d.groups = nil
+	d.mu.Unlock()
+
+	for _, group := range groups {
+		message := d.message(group.pictures)
+		sheet := d.contactSheet(group.pictures)
+		if len(sheet) > 0 {
+			message.Attachments = append([]string{sheet}, message.Attachments...)
+		}
+		err := group.notifier.Notify(message)
+		if len(sheet) > 0 {
+			os.Remove(sheet)
+		}
+		for i := range group.pictures {
+			group.pictures[i].cleanup()
+		}
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		for i := range group.pictures {
+			removeFromCamera(&group.pictures[i], remove)
+		}
+	}
+}
+
+// summary of the pictures, with the most confident attached
+func (d *digest) message(pictures []Picture) notify.Message {
+
+	sort.SliceStable(pictures, func(i, j int) bool {
+		return pictures[i].timeStamp < pictures[j].timeStamp
+	})
+	first, last := pictures[0], pictures[len(pictures)-1]
+
+	text := fmt.Sprintf("%s: %d files from %s to %s", cameraTitle(first.camera), len(pictures), first.timeStamp, last.timeStamp)
+	if last.battery >= 0 {
+		if last.battery > 100 {
+			text += ", battery charging"
+		} else {
+			text += fmt.Sprintf(", battery at %d%%", last.battery)
+		}
+	}
+
+	// pictures of each species
+	//
+	counts := make(map[string]int)
+	var confident []Picture
+	for _, picture := range pictures {
+		described := false
+		if picture.result != nil {
+			for _, label := range picture.result.Labels {
+				if label.Score > d.cutoff {
+					counts[strings.Replace(label.Name, "_", " ", -1)]++
+					described = true
+				}
+			}
+		}
+		if described {
+			confident = append(confident, picture)
+		} else {
+			counts["nothing detected"]++
+		}
+	}
+	species := make([]string, 0, len(counts))
+	for name := range counts {
+		species = append(species, name)
+	}
+	sort.Slice(species, func(i, j int) bool {
+		if counts[species[i]] == counts[species[j]] {
+			return species[i] < species[j]
+		}
+		return counts[species[i]] > counts[species[j]]
+	})
+	for _, name := range species {
+		text += fmt.Sprintf("\n%s %d", name, counts[name])
+	}
+
+	// annotated copies of the most confident
+	//
+	sort.SliceStable(confident, func(i, j int) bool {
+		return confident[i].result.Labels[0].Score > confident[j].result.Labels[0].Score
+	})
+	if len(confident) > d.top {
+		confident = confident[:d.top]
+	}
+	var attachments []string
+	for _, picture := range confident {
+		switch {
+		case len(picture.result.Still) > 0:
+			attachments = append(attachments, picture.result.Still)
+		case len(picture.result.Preview) > 0:
+			attachments = append(attachments, picture.result.Preview)
+		default:
+			attachments = append(attachments, picture.result.Output)
+		}
+	}
+
+	return notify.Message{Text: text, Attachments: attachments}
+}
+
+// contact sheet of the confident pictures in time order, or "" if there are
+// fewer than two
+func (d *digest) contactSheet(pictures []Picture) string {
+	if !d.sheet {
+		return ""
+	}
+
+	var confident []Picture
+	for _, picture := range pictures {
+		if picture.result != nil && len(picture.result.Labels) > 0 && picture.result.Labels[0].Score > d.cutoff {
+			confident = append(confident, picture)
+		}
+	}
+	if len(confident) > maxSheetTiles {
+		sort.SliceStable(confident, func(i, j int) bool {
+			return confident[i].result.Labels[0].Score > confident[j].result.Labels[0].Score
+		})
+		confident = confident[:maxSheetTiles]
+	}
+	sort.SliceStable(confident, func(i, j int) bool {
+		return confident[i].timeStamp < confident[j].timeStamp
+	})
+
+	var tiles []montage.Tile
+	for _, picture := range confident {
+		if tile, ok := sheetTile(picture.result, picture.timeStamp, d.cutoff); ok {
+			tiles = append(tiles, tile)
+		}
+	}
+	if len(tiles) < 2 {
+		return ""
+	}
+	sheet, err := writeSheet(digestSheet, tiles)
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+	return sheet
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plord12/trailcameradownload/camera"
+	"github.com/plord12/trailcameradownload/camera/cameratest"
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/montage"
+	"github.com/plord12/trailcameradownload/notify"
+)
+
+func TestDigestMessage(t *testing.T) {
+
+	dir := t.TempDir()
+	detected := func(name string, labels ...detection.Label) *detection.Result {
+		output := filepath.Join(dir, name)
+		os.WriteFile(output, []byte(name), 0644)
+		return &detection.Result{Output: output, Labels: labels}
+	}
+	pictures := []Picture{
+		{camera: "garden", timeStamp: "2022/12/06 05:43:40", battery: 80, result: detected("fox.mp4", detection.Label{Name: "Red_Fox", Score: 0.6})},
+		{camera: "garden", timeStamp: "2022/12/05 21:03:10", battery: 80},
+		{camera: "garden", timeStamp: "2022/12/05 22:00:00", battery: 80, result: detected("pigeon.jpg", detection.Label{Name: "Wood_Pigeon", Score: 0.9})},
+		{camera: "garden", timeStamp: "2022/12/05 23:00:00", battery: 80, result: detected("both.jpg",
+			detection.Label{Name: "Wood_Pigeon", Score: 0.3}, detection.Label{Name: "Red_Fox", Score: 0.2})},
+		{camera: "garden", timeStamp: "2022/12/05 23:30:00", battery: 80, result: detected("faint.jpg", detection.Label{Name: "Person", Score: 0.01})},
+	}
+
+	pictures[0].result.Preview = filepath.Join(dir, "fox.gif")
+
+	message := newDigest(2, false, detection.DefaultCutoff).message(pictures)
+	expected := "Camera garden: 5 files from 2022/12/05 21:03:10 to 2022/12/06 05:43:40, battery at 80%\n" +
+		"Red Fox 2\nWood Pigeon 2\nnothing detected 2"
+	if message.Text != expected {
+		t.Errorf("unexpected text %q", message.Text)
+	}
+	if !reflect.DeepEqual(message.Attachments, []string{filepath.Join(dir, "pigeon.jpg"), filepath.Join(dir, "fox.gif")}) {
+		t.Errorf("unexpected attachments %v", message.Attachments)
+	}
+}
+
+func TestDigestPipeline(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	now := time.Now()
+	server.AddPhoto("IM_00001.JPG", []byte("photo"), now)
+	server.AddPhoto("IM_00002.JPG", []byte("photo"), now.Add(time.Minute))
+	server.AddMovie("VD_00001.MP4", []byte("movie"), now.Add(2*time.Minute))
+
+	client := camera.NewClient(server.Hostname())
+	files, err := listFiles(client)
+	if err != nil {
+		t.Fatalf("failed to list files - %v", err)
+	}
+	var pictures []Picture
+	for _, file := range files {
+		pictures = append(pictures, Picture{fileName: file.FPath, timeStamp: file.Time, file: file, camera: "garden", battery: -1})
+	}
+
+	// nothing is deleted if the digest fails
+	//
+	notifier := &recordingNotifier{err: errors.New("digest failed")}
+	stages := cameraStages(client, false, nil, notify.Digest{Notifier: notifier})
+	stages.digest = newDigest(4, true, detection.DefaultCutoff)
+	limits := 5
+	runPipeline(context.Background(), pictures, pipelineConfig{queue: 1}, stages, &limits)
+
+	if len(notifier.messages) != 1 || len(server.Files()) != 3 {
+		t.Fatalf("expected one failed digest and files left on camera, got %v", notifier.messages)
+	}
+
+	// webhooks still get each capture as well as the digest
+	//
+	var mu sync.Mutex
+	var payloads []notify.WebhookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload notify.WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		payloads = append(payloads, payload)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	notifier.err = nil
+	stages.notify = notify.Digest{Notifier: notify.Multi{notifier, &notify.Webhook{URL: webhook.URL}}}
+	stages.digest = newDigest(4, true, detection.DefaultCutoff)
+	runPipeline(context.Background(), pictures, pipelineConfig{queue: 1, notifiers: 2}, stages, &limits)
+
+	if len(notifier.messages) != 2 {
+		t.Fatalf("expected one digest per run, got %d messages", len(notifier.messages))
+	}
+	captures := 0
+	for _, payload := range payloads {
+		if payload.Type == "capture" && len(payload.File) > 0 && len(payload.Text) == 0 {
+			captures++
+		}
+	}
+	if len(payloads) != 4 || captures != 3 {
+		t.Errorf("expected three captures and the digest posted, got %+v", payloads)
+	}
+	expected := "Camera garden: 3 files from " + files[0].Time + " to " + files[2].Time + "\nnothing detected 3"
+	if notifier.messages[1].Text != expected {
+		t.Errorf("unexpected digest %q", notifier.messages[1].Text)
+	}
+	if len(server.Files()) != 0 {
+		t.Errorf("files left on camera %v", server.Files())
+	}
+}
+
+func TestNotifierDigest(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	now := time.Now()
+	server.AddPhoto("IM_00001.JPG", []byte("photo"), now)
+	server.AddPhoto("IM_00002.JPG", []byte("photo"), now.Add(time.Minute))
+
+	client := camera.NewClient(server.Hostname())
+	files, err := listFiles(client)
+	if err != nil {
+		t.Fatalf("failed to list files - %v", err)
+	}
+	var pictures []Picture
+	for _, file := range files {
+		pictures = append(pictures, Picture{fileName: file.FPath, timeStamp: file.Time, file: file, camera: "garden", battery: -1})
+	}
+
+	// one notifier gets each file, the other a digest
+	//
+	each := &recordingNotifier{}
+	digested := &recordingNotifier{}
+	stages := cameraStages(client, false, nil, notify.Multi{each, notify.Digest{Notifier: digested}})
+	stages.digest = newDigest(4, false, detection.DefaultCutoff)
+	limits := 5
+	runPipeline(context.Background(), pictures, pipelineConfig{queue: 1}, stages, &limits)
+
+	if len(each.messages) != 2 || len(digested.messages) != 1 {
+		t.Errorf("expected a message per file and one digest, got %d and %d", len(each.messages), len(digested.messages))
+	}
+	if len(server.Files()) != 0 {
+		t.Errorf("files left on camera %v", server.Files())
+	}
+
+	// nothing is deleted, or digested, if the others fail
+	//
+	server.AddPhoto("IM_00003.JPG", []byte("photo"), now.Add(2*time.Minute))
+	files, _ = listFiles(client)
+	pictures = []Picture{{fileName: files[0].FPath, timeStamp: files[0].Time, file: files[0], camera: "garden", battery: -1}}
+	each.err = errors.New("failed")
+	runPipeline(context.Background(), pictures, pipelineConfig{queue: 1}, stages, &limits)
+
+	if len(digested.messages) != 1 || len(server.Files()) != 1 {
+		t.Errorf("expected no digest and file left on camera, got %d and %v", len(digested.messages), server.Files())
+	}
+}
+
+func TestDigestContactSheet(t *testing.T) {
+
+	dir := t.TempDir()
+	annotated := func(name string, labels ...detection.Label) *detection.Result {
+		output := filepath.Join(dir, name)
+		img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		if err := montage.WriteJPEG(output, img); err != nil {
+			t.Fatal(err)
+		}
+		return &detection.Result{Output: output, Labels: labels}
+	}
+
+	notifier := &recordingNotifier{}
+	d := newDigest(1, true, detection.DefaultCutoff)
+	to := route{rule: -1, action: actionNotify, notifier: notifier}
+	d.add(to, Picture{camera: "garden", timeStamp: "2022/12/06 05:43:40", battery: -1, result: annotated("fox.jpg", detection.Label{Name: "Red_Fox", Score: 0.6})})
+	d.add(to, Picture{camera: "garden", timeStamp: "2022/12/05 22:00:00", battery: -1, result: annotated("pigeon.jpg", detection.Label{Name: "Wood_Pigeon", Score: 0.9})})
+	d.add(to, Picture{camera: "garden", timeStamp: "2022/12/05 23:00:00", battery: -1, result: &detection.Result{Output: filepath.Join(dir, "movie.mp4")}})
+
+	var removed int
+	d.send(func(picture *Picture) error {
+		removed++
+		return nil
+	})
+
+	// contact sheet first, then the most confident
+	//
+	if len(notifier.messages) != 1 || removed != 3 {
+		t.Fatalf("expected one digest removing 3 files, got %v and %d", notifier.messages, removed)
+	}
+	attachments := notifier.messages[0].Attachments
+	if len(attachments) != 2 || !strings.HasPrefix(filepath.Base(attachments[0]), "montage.") || attachments[1] != filepath.Join(dir, "pigeon.jpg") {
+		t.Errorf("unexpected attachments %v", attachments)
+	}
+	if _, err := os.Stat(attachments[0]); !os.IsNotExist(err) {
+		t.Errorf("contact sheet not removed")
+	}
+
+	expected := []string{"Red Fox 60.0%", "2022/12/06 05:43:40"}
+	if captions := caption(&detection.Result{Labels: []detection.Label{{Name: "Red_Fox", Score: 0.6}, {Name: "Person", Score: 0.01}}}, "2022/12/06 05:43:40", detection.DefaultCutoff); !reflect.DeepEqual(captions, expected) {
+		t.Errorf("unexpected caption %v", captions)
+	}
+}
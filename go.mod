@@ -4,7 +4,9 @@ go 1.19
 
 require (
 	github.com/Wifx/gonetworkmanager v0.4.0
+	github.com/eclipse/paho.mqtt.golang v1.4.2
 	github.com/mattn/go-tflite v1.0.4
+	github.com/robfig/cron/v3 v3.0.1
 	gocv.io/x/gocv v0.31.0
 	golang.org/x/image v0.1.0
 	tinygo.org/x/bluetooth v0.6.0
@@ -14,10 +16,14 @@ require (
 	github.com/fatih/structs v1.1.0 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/godbus/dbus/v5 v5.0.3 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/mattn/go-pointer v0.0.1 // indirect
 	github.com/muka/go-bluetooth v0.0.0-20220830075246-0746e3a1ea53 // indirect
 	github.com/saltosystems/winrt-go v0.0.0-20220826130236-ddc8202da421 // indirect
 	github.com/sirupsen/logrus v1.9.0 // indirect
 	github.com/tinygo-org/cbgo v0.0.4 // indirect
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b // indirect
+	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4 // indirect
 	golang.org/x/sys v0.0.0-20220829200755-d48e67d00261 // indirect
+	golang.org/x/text v0.4.0 // indirect
 )
@@ -2,16 +2,15 @@ package main
 
 import (
 	"bufio"
-	"encoding/xml"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -21,51 +20,212 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/Wifx/gonetworkmanager"
+	"github.com/plord12/trailcameradownload/camera"
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/montage"
+	"github.com/plord12/trailcameradownload/notify"
+	"github.com/plord12/trailcameradownload/preview"
 	"tinygo.org/x/bluetooth"
 )
 
 var adapter = bluetooth.DefaultAdapter
+var bluetoothEnabled = false
 
-type Picture struct {
-	fileName    string
-	tmpFilename string
-	timeStamp   string
+var modelLoaded = false
+var loadedModelPath string
+var loadedLabelPath string
+var loadedXnnpack bool
+var loadedClassifierPath string
+var loadedClassifierLabelPath string
+
+// detection settings of the camera being processed
+var detectSettings = defaultDetect
+
+// detection settings used by default, as for the flags
+var defaultDetect = detectOptions{
+	thresholds:      detection.Thresholds{Default: detection.DefaultThreshold},
+	suppression:     detection.DefaultSuppression,
+	cutoff:          detection.DefaultCutoff,
+	classifierScore: 0.7,
+	motion:          motionOptions{area: 0.002, crop: true},
+	preview:         preview.Options{Width: 480, Duration: 10 * time.Second, MaxBytes: 2000000},
+	trimPadding:     2 * time.Second,
 }
 
-var wg sync.WaitGroup
+// videos cut down to their detections
+const (
+	trimAnnotated = "annotated"
+	trimOriginal  = "original"
+	trimBoth      = "both"
+)
 
-var modelLoaded = false
+// settings for object detection beyond the model
+type detectOptions struct {
+	thresholds      detection.Thresholds
+	suppression     detection.Suppression
+	cutoff          float64
+	classifierScore float64
+	classify        string
+	motion          motionOptions
+	preview         preview.Options
+	trim            string
+	trimPadding     time.Duration
+}
+
+// whether the classifier refines boxes labelled label, all if none are listed
+func (d detectOptions) classifies(label string) bool {
+	if len(d.classify) == 0 {
+		return true
+	}
+	for _, name := range strings.Split(d.classify, ",") {
+		if strings.TrimSpace(name) == label {
+			return true
+		}
+	}
+	return false
+}
+
+// score a label needs to be described
+func (d detectOptions) labelCutoff() float64 {
+	if d.cutoff > 0 {
+		return d.cutoff
+	}
+	return detection.DefaultCutoff
+}
+
+// settings for a download run
+type options struct {
+	name             string
+	address          string
+	uuid             string
+	ssid             string
+	password         string
+	signalUser       string
+	signalGroup      string
+	signalRecipient  string
+	signalRPC        string
+	signalPartial    bool
+	smtpAddr         string
+	smtpUser         string
+	smtpPassword     string
+	emailFrom        string
+	emailTo          string
+	emailInline      bool
+	emailDigest      bool
+	mqttBroker       string
+	mqttUser         string
+	mqttPassword     string
+	mqttTopic        string
+	mqttDiscovery    string
+	webhook          string
+	webhookSecret    string
+	webhookMultipart bool
+	modelPath        string
+	labelPath        string
+	classifierPath   string
+	classifierLabel  string
+	labelsChecked    bool
+	xnnpack          bool
+	limits           int
+	detect           detectOptions
+	savejpg          bool
+	undeletedfiles   bool
+	mount            string
+	retries          int
+	scanTime         time.Duration
+	archive          string
+	digest           bool
+	digestTop        int
+	digestMontage    bool
+	stillOnly        bool
+	notifier         notify.Notifier
+	router           *router
+	pipeline         pipelineConfig
+}
 
 func main() {
 
 	// parse arguments
 	//
-	address := flag.String("address", "D6:30:35:.*", "Bluetooth address")
-	uuid := flag.String("characteristic", "0000ffe9-0000-1000-8000-00805f9b34fb", "Bluetooth characteristic UUID")
-	ssid := flag.String("ssid", "CEYOMUR-.*", "WiFi SSID")
-	password := flag.String("password", "12345678", "WiFi password")
-	signalUser := flag.String("signaluser", "", "Signal messenger username")
-	signalGroup := flag.String("signalgroup", "", "Signal messenger group id")
-	signalRecipient := flag.String("signalrecipient", "", "Signal messenger recipient - quote for multiple users")
-	modelPath := flag.String("model", "detect.tflite", "path to model file")
-	labelPath := flag.String("label", "labelmap.txt", "path to label file")
-	limits := flag.Int("limits", 5, "limits of items")
-	savejpg := flag.Bool("savejpg", false, "save jpg files to $HOME/photos")
+	opts := &options{}
+	flag.StringVar(&opts.address, "address", "D6:30:35:.*", "Bluetooth address")
+	flag.StringVar(&opts.uuid, "characteristic", "0000ffe9-0000-1000-8000-00805f9b34fb", "Bluetooth characteristic UUID")
+	flag.StringVar(&opts.ssid, "ssid", "CEYOMUR-.*", "WiFi SSID")
+	flag.StringVar(&opts.password, "password", "12345678", "WiFi password")
+	notifyFlags(flag.CommandLine, opts)
+	flag.StringVar(&opts.modelPath, "model", "detect.tflite", "path to model file")
+	flag.StringVar(&opts.labelPath, "label", "labelmap.txt", "path to label file")
+	flag.StringVar(&opts.classifierPath, "classifier", "", "path to second stage classifier model file, run on each box")
+	flag.StringVar(&opts.classifierLabel, "classifierlabel", "classifierlabel.txt", "path to classifier label file")
+	flag.Float64Var(&opts.detect.classifierScore, "classifierscore", defaultDetect.classifierScore, "classifier score needed to replace the label of a box")
+	flag.StringVar(&opts.detect.classify, "classify", "", "comma separated labels the classifier refines, all if not given")
+	flag.BoolVar(&opts.detect.motion.enabled, "motion", false, "skip detection on video frames without motion")
+	flag.Float64Var(&opts.detect.motion.area, "motionarea", defaultDetect.motion.area, "fraction of a frame that must change to count as motion")
+	flag.BoolVar(&opts.detect.motion.crop, "motioncrop", defaultDetect.motion.crop, "only look for objects in the moving part of a frame")
+	flag.Float64Var(&opts.detect.thresholds.Default, "threshold", defaultDetect.thresholds.Default, "score a box needs to count as a detection, unless set for its label")
+	flag.Float64Var(&opts.detect.suppression.LabelIoU, "nms", defaultDetect.suppression.LabelIoU, "drop boxes overlapping a better one of the same label by more than this IoU, 0 to disable")
+	flag.Float64Var(&opts.detect.suppression.AnyIoU, "nmsany", defaultDetect.suppression.AnyIoU, "drop boxes overlapping a better one of any label by more than this IoU, 0 to disable")
+	flag.Float64Var(&opts.detect.cutoff, "cutoff", defaultDetect.cutoff, "score a label needs to be described")
+	flag.IntVar(&opts.limits, "limits", 5, "limits of items")
+	flag.StringVar(&opts.detect.preview.Format, "preview", "", "send a short preview of videos rather than the annotated video - gif or mp4")
+	flag.StringVar(&opts.detect.trim, "trim", "", "cut videos down to the parts with detections - annotated, original or both")
+	flag.DurationVar(&opts.detect.trimPadding, "trimpadding", defaultDetect.trimPadding, "time kept either side of detections when trimming videos")
+	flag.BoolVar(&opts.stillOnly, "stillonly", false, "send only the best frame of videos, without the video or preview")
+	flag.IntVar(&opts.detect.preview.Width, "previewwidth", defaultDetect.preview.Width, "preview width in pixels")
+	flag.DurationVar(&opts.detect.preview.Duration, "previewduration", defaultDetect.preview.Duration, "longest preview")
+	flag.Int64Var(&opts.detect.preview.MaxBytes, "previewsize", defaultDetect.preview.MaxBytes, "largest preview in bytes, the frame rate is reduced to fit")
+	flag.BoolVar(&opts.savejpg, "savejpg", false, "save jpg files to $HOME/photos")
+	flag.BoolVar(&opts.digest, "digest", false, "send one summary per run rather than a message per file")
+	flag.IntVar(&opts.digestTop, "digesttop", 4, "number of the most confident detections attached to a digest")
+	flag.BoolVar(&opts.digestMontage, "digestmontage", true, "attach a contact sheet of the detections to a digest")
+	flag.StringVar(&opts.archive, "archive", "", "`directory` for files archived by rules, default $HOME/photos")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
 	memprofile := flag.String("memprofile", "", "write memory profile to `file`")
-	xnnpack := flag.Bool("xnnpack", false, "use XNNPACK delegate")
-	undeletedfiles := flag.Bool("undeletedfiles", false,
+	flag.BoolVar(&opts.xnnpack, "xnnpack", false, "use XNNPACK delegate")
+	flag.BoolVar(&opts.undeletedfiles, "undeletedfiles", false,
 		"maintain list of undeleted files in $HOME/.undeleted-[Bluetooth address]")
 	testfiles := flag.String("testfiles", "", "list of testfiles - disables connecting to camera")
-	mount := flag.String("mount", "/mnt/trailcamera", "Locally mounted USB directory")
+	testMontage := flag.String("montage", "", "write a contact sheet of the testfiles detections to `file`")
+	flag.StringVar(&opts.mount, "mount", "/mnt/trailcamera", "Locally mounted USB directory")
+	flag.IntVar(&opts.retries, "retries", 3, "download retries per file")
+	flag.IntVar(&opts.pipeline.downloaders, "downloaders", 1, "number of concurrent downloads")
+	flag.IntVar(&opts.pipeline.detectors, "detectors", 1, "number of concurrent object detections")
+	flag.IntVar(&opts.pipeline.notifiers, "notifiers", 1, "number of concurrent notifications and deletes")
+	flag.IntVar(&opts.pipeline.queue, "queue", 2, "files queued between each stage")
+	daemon := flag.Bool("daemon", false, "keep running, downloading on a schedule")
+	interval := flag.Duration("interval", time.Hour, "time between downloads in daemon mode")
+	schedule := flag.String("schedule", "", "cron expression for downloads in daemon mode - overrides interval")
+	configPath := flag.String("config", "", "path to JSON config `file` - command line flags override its settings")
+	cameraName := flag.String("camera", "", "camera profile from the config file, all cameras if not given")
+	flag.StringVar(&opts.name, "name", "", "camera name used in alerts")
+	flag.DurationVar(&opts.scanTime, "scantime", 10*time.Second, "time to scan bluetooth for cameras")
 
 	flag.Parse()
 
+	// settings from the config file, unless given on the command line
+	//
+	cameras := []options{*opts}
+	var rules []rule
+	var targets map[string]map[string]interface{}
+	var thresholds map[string]float64
+	if len(*configPath) > 0 {
+		config, err := loadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("could not load config: %s", err.Error())
+		}
+		cameras, err = config.profiles(flag.CommandLine, *cameraName, opts)
+		if err != nil {
+			log.Fatalf("could not load config: %s", err.Error())
+		}
+		rules, targets, thresholds = config.rules, config.targets, config.thresholds
+	}
+
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -78,531 +238,763 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	var err error
-	var bluetoothDevice *bluetooth.Device
-	var bluetoothAdress string
+	for i := range cameras {
+		switch cameras[i].detect.preview.Format {
+		case "", preview.GIF, preview.MP4:
+		default:
+			log.Fatalf("unknown preview format %s", cameras[i].detect.preview.Format)
+		}
+		switch cameras[i].detect.trim {
+		case "", trimAnnotated, trimOriginal, trimBoth:
+		default:
+			log.Fatalf("unknown trim %s", cameras[i].detect.trim)
+		}
+		cameras[i].detect.thresholds.Labels = thresholds
+		notifier, err := newNotifier(&cameras[i])
+		if err != nil {
+			log.Fatalf("could not set up notifications: %s", err.Error())
+		}
+		cameras[i].notifier = notifier
+		if len(rules) > 0 {
+			router, err := newRouter(rules, targets, &cameras[i])
+			if err != nil {
+				log.Fatalf("could not load rules: %s", err.Error())
+			}
+			cameras[i].router = router
+		}
+	}
 
 	// load model early
 	//
-	// if failed, report error and continue
-	err = loadModel(modelPath, labelPath, xnnpack)
-	if err != nil {
-		log.Println(err.Error())
-	} else {
-		modelLoaded = true
-	}
+	useModel(&cameras[0])
 
 	if len(*testfiles) > 0 {
+		var tiles []montage.Tile
 		for _, picture := range strings.Split(*testfiles, ",") {
-			outputfileName, description, _, err := objectDetect(&picture, limits, true)
-			if err == nil {
-				destinationFile := strings.TrimSuffix(picture, filepath.Ext(picture)) + "-out" + filepath.Ext(picture)
-				input, err := ioutil.ReadFile(*outputfileName)
+			result, err := objectDetect(&picture, &cameras[0].limits, true)
+			if err != nil {
+				log.Printf("Detection failed - %s\n", err.Error())
+				continue
+			}
+			if result == nil {
+				log.Printf("No model loaded\n")
+				break
+			}
+			destinationFile := strings.TrimSuffix(picture, filepath.Ext(picture)) + "-out" + filepath.Ext(picture)
+			input, err := ioutil.ReadFile(result.Output)
+			if err != nil {
+				log.Printf("Read processed file failed - %s\n", err.Error())
+			} else {
+				err = ioutil.WriteFile(destinationFile, input, 0644)
 				if err != nil {
-					log.Printf("Read processed file failed - %s\n", err.Error())
+					log.Printf("Write processed file failed - %s\n", err.Error())
 				} else {
-					err = ioutil.WriteFile(destinationFile, input, 0644)
-					if err != nil {
-						log.Printf("Write processed file failed - %s\n", err.Error())
-					} else {
-						log.Printf("%s -> %s, %s\n", picture, destinationFile, *description)
-					}
+					log.Printf("%s -> %s, %s\n", picture, destinationFile, result.Description)
+				}
+			}
+			if len(*testMontage) > 0 {
+				timeStamp := ""
+				if fileInfo, err := os.Stat(picture); err == nil {
+					timeStamp = fileInfo.ModTime().Format("2006/01/02 15:04:05")
+				}
+				if tile, ok := sheetTile(result, timeStamp, cameras[0].detect.labelCutoff()); ok {
+					tiles = append(tiles, tile)
 				}
-			} else {
-				log.Printf("Detection failed - %s\n", err.Error())
 			}
-			os.Remove(*outputfileName)
+			os.Remove(result.Output)
+		}
+		if len(*testMontage) > 0 {
+			img, err := testSheet.Draw(tiles)
+			if err == nil {
+				err = montage.WriteJPEG(*testMontage, img)
+			}
+			if err != nil {
+				log.Fatalf("could not write montage: %s", err.Error())
+			}
+			log.Printf("Contact sheet of %d files at %s\n", len(tiles), *testMontage)
 		}
 		return
 	}
 
-	// check if camera is locally mounted
+	// SIGTERM finishes the current file then disables the camera WiFi
 	//
-	_, err = os.Stat(path.Join(*mount, "DCIM"))
-	if err == nil {
-		log.Printf("Camera USB mounted")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-		// list files, sorted by date
-		//
-		type fileStruct struct {
-			fileName string
-			modTime  time.Time
-		}
-		var files []fileStruct
-
-		entries, err := os.ReadDir(path.Join(*mount, "DCIM", "MOVIE"))
-		if err != nil {
-			log.Println(err.Error())
-			alert(signalUser, signalRecipient, signalGroup, "Camera: unable to list files on USB", "")
-			os.Exit(1)
-		}
-		for _, e := range entries {
-			var file fileStruct
-			fileInfo, _ := e.Info()
-			file.fileName = path.Join(*mount, "DCIM", "MOVIE", fileInfo.Name())
-			file.modTime = fileInfo.ModTime()
-			files = append(files, file)
-		}
+	var err error
+	if *daemon {
+		err = runDaemon(ctx, cameras, *interval, *schedule)
+	} else {
+		err = run(ctx, cameras)
+	}
 
-		entries, err = os.ReadDir(path.Join(*mount, "DCIM", "PHOTO"))
+	if *memprofile != "" {
+		f, err := os.Create(*memprofile)
 		if err != nil {
-			log.Println(err.Error())
-			alert(signalUser, signalRecipient, signalGroup, "Camera: unable to list files on USB", "")
-			os.Exit(1)
+			log.Fatalf("could not create memory profile: %s\n", err)
 		}
-		for _, e := range entries {
-			var file fileStruct
-			fileInfo, _ := e.Info()
-			file.fileName = path.Join(*mount, "DCIM", "PHOTO", fileInfo.Name())
-			file.modTime = fileInfo.ModTime()
-			files = append(files, file)
+		defer f.Close() // error handling omitted for example
+		runtime.GC()    // get up-to-date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			log.Fatalf("could not write memory profile: %s\n", err)
 		}
+	}
 
-		// sort by ModTime
-		//
-		sort.Slice(files, func(i, j int) bool {
-			return files[i].modTime.Before(files[j].modTime)
-		})
-
-		log.Printf("%d files on camera\n", len(files))
-
-		alert(signalUser, signalRecipient, signalGroup, "Camera: USB connected "+strconv.Itoa(len(files))+" files to download", "")
+	if err != nil {
+		log.Println(err.Error())
+		stop()
+		pprof.StopCPUProfile()
+		os.Exit(1)
+	}
+}
 
-		jobChan := make(chan Picture, len(files))
-		wg.Add(1)
-		go workerLocal(jobChan, signalUser, signalRecipient, signalGroup, limits, len(files))
+// a single download run, from the locally mounted camera if present otherwise
+// each camera found over bluetooth in turn
+func run(ctx context.Context, cameras []options) error {
 
-		for i := 0; i < len(files); i++ {
-			// queue processing and deleting
-			jobChan <- Picture{files[i].fileName, files[i].fileName, files[i].modTime.String()}
+	// identifies the alerts from this run
+	//
+	runID := time.Now().Format("20060102-150405")
 
-			// save a copy of the file
-			if *savejpg && (strings.EqualFold(filepath.Ext(files[i].fileName), ".JPG") || strings.EqualFold(filepath.Ext(files[i].fileName), ".JPEG")) {
-				source, err := os.Open(files[i].fileName)
-				if err != nil {
-					log.Printf("Unable to open %s for copy - %s\n", files[i].fileName, err.Error())
-					break
-				}
-				defer source.Close()
-				destination, err := ioutil.TempFile(os.Getenv("HOME")+"/photos/", strings.Replace(strings.Replace(files[i].modTime.String()+".*.jpg", "/", "_", -1), " ", "_", -1))
-				if err != nil {
-					log.Printf("Unable to open %s for copy - %s\n", os.Getenv("HOME")+"/photos/"+files[i].modTime.String()+".*.jpg", err.Error())
-					break
-				}
-				_, err = io.Copy(destination, source)
-				if err != nil {
-					log.Printf("Unable to copy %s - %s\n", files[i].fileName, err.Error())
-					break
-				}
-				defer destination.Close()
-			}
+	for i := range cameras {
+		_, err := os.Stat(path.Join(cameras[i].mount, "DCIM"))
+		if err == nil {
+			useModel(&cameras[i])
+			return runUSB(ctx, &cameras[i], runID)
 		}
+	}
 
-		log.Println("Finished download")
+	var devices []discoveredCamera
+	var err error
+	for attempt := 1; attempt < 4; attempt++ {
+		devices, err = discoverCameras(cameras)
+		if err == nil && len(devices) > 0 {
+			break
+		}
+		if err == nil {
+			err = errors.New("no cameras found")
+		}
+		log.Printf("Bluetooth discovery failed [%d of 3] - %s\n", attempt, err.Error())
 
-		// wait for queue to complete
+		// give the cameras longer to wake up each time
 		//
-		close(jobChan)
-		wg.Wait()
-		log.Println("Finished")
+		if attempt < 3 && !retryWait(ctx, time.Duration(attempt)*10*time.Second) {
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		devices = nil
+	}
+	for _, opts := range undiscovered(cameras, devices) {
+		opts.notifier.Notify(notify.Message{Text: cameraTitle(opts.name) + ": unable to find camera via bluetooth", Severity: notify.Warning})
+	}
+	if err != nil {
+		return err
+	}
 
-	} else {
+	failed := 0
+	for _, device := range devices {
+		if ctx.Err() != nil {
+			break
+		}
 
-		// enable wifi via bluetooth command
+		// name cameras in alerts when there is more than one
 		//
-		for attempt := 1; attempt < 10; attempt++ {
-			bluetoothDevice, bluetoothAdress, err = connectBluetooth(address)
-			if err != nil {
-				log.Printf("Bluetooth connect failed [%d of 10] - %s\n", attempt, string(err.Error()))
-				if bluetoothDevice != nil {
-					disableBluetooth(bluetoothDevice, uuid)
-				}
-				// wait a bit betwwen attempts
-				//
-				time.Sleep(2 * time.Second)
-			} else {
-				break
-			}
-		}
-		if err != nil {
-			if bluetoothDevice != nil {
-				disableBluetooth(bluetoothDevice, uuid)
-			}
-			log.Println(err.Error())
-			alert(signalUser, signalRecipient, signalGroup, "Camera: unable to connect via bluetooth", "")
-			os.Exit(1)
-		}
-		for attempt := 1; attempt < 10; attempt++ {
-			err = enableWifi(bluetoothDevice, uuid)
-			if err != nil {
-				log.Printf("Enable WiFi failed [%d of 10] - %s\n", attempt, string(err.Error()))
-			} else {
-				break
+		name := device.opts.name
+		if len(name) == 0 && len(devices) > 1 {
+			name = device.localName
+			if len(name) == 0 {
+				name = device.address
 			}
-			time.Sleep(2 * time.Second)
 		}
+
+		useModel(device.opts)
+		err = runCamera(ctx, device.opts, device, name, runID)
 		if err != nil {
-			disableBluetooth(bluetoothDevice, uuid)
-			log.Println(err.Error())
-			alert(signalUser, signalRecipient, signalGroup, "Camera: unable to connect via WiFi", "")
-			os.Exit(1)
+			log.Printf("%s: %s\n", cameraTitle(name), err.Error())
+			failed++
 		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cameras failed", failed, len(devices))
+	}
 
-		// connect to wifi - loop and wait
-		//
-		var hostname string
-		var nm gonetworkmanager.NetworkManager
-		var activeConnection gonetworkmanager.ActiveConnection
+	return nil
+}
 
-		for attempt := 1; attempt < 10; attempt++ {
-			nm, activeConnection, hostname, err = connectWifi(ssid, password)
-			if err != nil {
-				log.Printf("WiFi connect failed [%d of 10] - %s", attempt, string(err.Error()))
-				if activeConnection != nil {
-					disableBluetooth(bluetoothDevice, uuid)
-					disconnectWifi(nm, activeConnection)
-				}
-				// wait a bit betwwen attempts
-				//
-				time.Sleep(2 * time.Second)
-			} else {
-				break
-			}
+// flags for where alerts are sent, also used for rule targets
+func notifyFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.signalUser, "signaluser", "", "Signal messenger username")
+	fs.StringVar(&opts.signalGroup, "signalgroup", "", "Signal messenger group id")
+	fs.StringVar(&opts.signalRecipient, "signalrecipient", "", "Signal messenger recipient - quote for multiple users")
+	fs.StringVar(&opts.signalRPC, "signalrpc", "",
+		"signal-cli daemon JSON-RPC `url` - http://host:port/api/v1/rpc, unix:///path/to/socket or tcp://host:port")
+	fs.BoolVar(&opts.signalPartial, "signalpartial", false, "with -signalrpc delete files once delivered to any recipient rather than all")
+	fs.StringVar(&opts.smtpAddr, "smtp", "", "SMTP server `host:port` for email alerts")
+	fs.StringVar(&opts.smtpUser, "smtpuser", "", "SMTP username")
+	fs.StringVar(&opts.smtpPassword, "smtppassword", "", "SMTP password")
+	fs.StringVar(&opts.emailFrom, "emailfrom", "", "email sender address")
+	fs.StringVar(&opts.emailTo, "emailto", "", "email recipients - quote for multiple addresses")
+	fs.BoolVar(&opts.emailInline, "emailinline", true, "show images inline in emails rather than as attachments")
+	fs.BoolVar(&opts.emailDigest, "emaildigest", false, "email one summary per run rather than a message per file")
+	fs.StringVar(&opts.mqttBroker, "mqtt", "", "MQTT broker `url` for status and detections, for example tcp://localhost:1883")
+	fs.StringVar(&opts.mqttUser, "mqttuser", "", "MQTT username")
+	fs.StringVar(&opts.mqttPassword, "mqttpassword", "", "MQTT password")
+	fs.StringVar(&opts.mqttTopic, "mqtttopic", "trailcamera", "MQTT base topic")
+	fs.StringVar(&opts.mqttDiscovery, "mqttdiscovery", "homeassistant", "Home Assistant MQTT discovery prefix - empty to disable")
+	fs.StringVar(&opts.webhook, "webhook", "", "`url` to POST a JSON document to for each alert")
+	fs.StringVar(&opts.webhookSecret, "webhooksecret", "", "secret to sign webhook requests with HMAC-SHA256")
+	fs.BoolVar(&opts.webhookMultipart, "webhookmultipart", false, "send webhook attachments as multipart parts rather than base64 in the JSON")
+}
+
+// notifiers configured for a camera, with digest set all getting a digest
+func newNotifier(opts *options) (notify.Notifier, error) {
+
+	var notifiers notify.Multi
+	if len(opts.signalRPC) > 0 && (len(opts.signalGroup) > 0 || len(opts.signalRecipient) > 0) {
+		notifiers = append(notifiers, &notify.SignalRPC{
+			URL:        opts.signalRPC,
+			Account:    opts.signalUser,
+			Group:      opts.signalGroup,
+			Recipients: strings.Fields(opts.signalRecipient),
+			Partial:    opts.signalPartial,
+		})
+	} else if len(opts.signalUser) > 0 && (len(opts.signalGroup) > 0 || len(opts.signalRecipient) > 0) {
+		notifiers = append(notifiers, &notify.Signal{
+			User:       opts.signalUser,
+			Group:      opts.signalGroup,
+			Recipients: strings.Fields(opts.signalRecipient),
+		})
+	}
+	if len(opts.smtpAddr) > 0 && len(opts.emailTo) > 0 {
+		if len(opts.emailFrom) == 0 {
+			return nil, errors.New("-emailfrom is needed to send email")
 		}
-		if err != nil {
-			if activeConnection != nil {
-				disableBluetooth(bluetoothDevice, uuid)
-				disconnectWifi(nm, activeConnection)
-			}
+		var email notify.Notifier = &notify.Email{
+			Addr:     opts.smtpAddr,
+			Username: opts.smtpUser,
+			Password: opts.smtpPassword,
+			From:     opts.emailFrom,
+			To:       strings.Fields(opts.emailTo),
+			Inline:   opts.emailInline,
+		}
+		if opts.emailDigest {
+			email = notify.Digest{Notifier: email}
+		}
+		notifiers = append(notifiers, email)
+	}
 
-			// wifi failed ... so some diagnostics
-			//
-			log.Println("WiFi connection failed")
-
-			log.Println("nmcli general status")
-			cmd := exec.Command("nmcli", "general", "status")
-			stdout, _ := cmd.CombinedOutput()
-			log.Println(string(stdout[:]))
-			log.Println("nmcli connection show")
-			cmd = exec.Command("nmcli", "connection", "show")
-			stdout, _ = cmd.CombinedOutput()
-			log.Println(string(stdout[:]))
-			log.Println("nmcli device status")
-			cmd = exec.Command("nmcli", "device", "status")
-			stdout, _ = cmd.CombinedOutput()
-			log.Println(string(stdout[:]))
-			log.Println("nmcli dev wifi list")
-			cmd = exec.Command("nmcli", "dev", "wifi", "list")
-			stdout, _ = cmd.CombinedOutput()
-			log.Println(string(stdout[:]))
-
-			os.Exit(1)
-		}
-
-		// get camera status
-		//
-		battery, _ := status(hostname)
+	// status and detections only, so a broker being down doesn't keep files
+	// on the camera
+	//
+	if len(opts.mqttBroker) > 0 {
+		notifiers = append(notifiers, notify.BestEffort{Notifier: &notify.MQTT{
+			Client:          notify.NewMQTTClient(opts.mqttBroker, opts.mqttUser, opts.mqttPassword),
+			Topic:           opts.mqttTopic,
+			Camera:          opts.name,
+			DiscoveryPrefix: opts.mqttDiscovery,
+			QoS:             1,
+		}})
+	}
+	if len(opts.webhook) > 0 {
+		notifiers = append(notifiers, &notify.Webhook{
+			URL:       opts.webhook,
+			Secret:    opts.webhookSecret,
+			Multipart: opts.webhookMultipart,
+		})
+	}
+	if opts.digest {
+		return notify.Digest{Notifier: notifiers}, nil
+	}
+	return notifiers, nil
+}
 
-		var undeletedPath string = ""
+// alert title, including the camera name if known
+func cameraTitle(name string) string {
+	if len(name) == 0 {
+		return "Camera"
+	}
+	return "Camera " + name
+}
 
-		// delete any old pictures first
-		//
-		if *undeletedfiles {
-			undeletedPath = os.Getenv("HOME") + "/.undeleted-" + bluetoothAdress
-			if _, err := os.Stat(undeletedPath); err == nil {
-				file, err := os.Open(undeletedPath)
-				if err != nil {
-					log.Printf("Unable to open undeleted file - %s\n", err.Error())
-				} else {
-					defer file.Close()
-					scanner := bufio.NewScanner(file)
-					for scanner.Scan() {
-						delete(scanner.Text(), hostname)
-					}
-					if err := scanner.Err(); err != nil {
-						log.Printf("Unable to read undeleted file - %s\n", err.Error())
-					}
-					file.Close()
-				}
-				os.Remove(undeletedPath)
-			}
+// warn of rule and threshold labels not in the labels of the loaded models,
+// once for each camera
+func checkLabels(opts *options) {
+	known := knownLabels()
+	if len(known) == 0 || opts.labelsChecked {
+		return
+	}
+	opts.labelsChecked = true
+	opts.router.check(known)
+	names := make(map[string]bool)
+	for _, name := range known {
+		names[name] = true
+	}
+	for name := range opts.detect.thresholds.Labels {
+		if !names[name] {
+			log.Printf("%s: threshold label %s is not in the label file\n", cameraTitle(opts.name), name)
 		}
+	}
+}
 
-		// download any new pictures
-		//
-		files, timestamps, err := listFiles(hostname)
+// load the model for a camera, unless already loaded, and check the camera's
+// labels against it
+//
+// if failed, report error and continue without detection
+func useModel(opts *options) {
+
+	detectSettings = opts.detect
+
+	// without the classifier labels aren't refined
+	//
+	// paths are only kept once loaded, so a failed load is tried again
+	//
+	if opts.classifierPath != loadedClassifierPath || opts.classifierLabel != loadedClassifierLabelPath {
+		err := loadClassifier(&opts.classifierPath, &opts.classifierLabel)
 		if err != nil {
-			if activeConnection != nil {
-				disableBluetooth(bluetoothDevice, uuid)
-				disconnectWifi(nm, activeConnection)
-			}
 			log.Println(err.Error())
-			alert(signalUser, signalRecipient, signalGroup, "Camera: unable to download files", "")
-			os.Exit(1)
+			loadedClassifierPath, loadedClassifierLabelPath = "", ""
+		} else {
+			loadedClassifierPath, loadedClassifierLabelPath = opts.classifierPath, opts.classifierLabel
 		}
+	}
 
-		if battery <= 20 {
-			alert(signalUser, signalRecipient, signalGroup,
-				"Camera: battery low at "+strconv.Itoa(battery)+"%, "+strconv.Itoa(len(files))+" files to download", "")
-		} else if battery > 100 {
-			alert(signalUser, signalRecipient, signalGroup,
-				"Camera: battery charging, "+strconv.Itoa(len(files))+" files to download", "")
+	if !modelLoaded || opts.modelPath != loadedModelPath || opts.labelPath != loadedLabelPath || opts.xnnpack != loadedXnnpack {
+		err := loadModel(&opts.modelPath, &opts.labelPath, &opts.xnnpack)
+		if err != nil {
+			log.Println(err.Error())
+			modelLoaded = false
+			loadedModelPath, loadedLabelPath, loadedXnnpack = "", "", false
 		} else {
-			alert(signalUser, signalRecipient, signalGroup,
-				"Camera: battery at "+strconv.Itoa(battery)+"%, "+strconv.Itoa(len(files))+" files to download", "")
+			modelLoaded = true
+			loadedModelPath, loadedLabelPath, loadedXnnpack = opts.modelPath, opts.labelPath, opts.xnnpack
 		}
+	}
 
-		jobChan := make(chan Picture, len(files))
-		wg.Add(1)
-		go worker(jobChan, hostname, signalUser, signalRecipient, signalGroup, limits, undeletedPath, len(files))
+	checkLabels(opts)
+}
 
-		for i := 0; i < len(files); i++ {
-			tmpFile, err := download(files[i], hostname)
-			if err != nil {
-				log.Printf("Failed to download %s - %s\n", files[i], err.Error())
-				os.Remove(tmpFile)
-				break
-			}
-			// queue processing and deleting
-			jobChan <- Picture{files[i], tmpFile, timestamps[i]}
+// process files on the locally mounted camera
+func runUSB(ctx context.Context, opts *options, runID string) error {
 
-			// save a copy of the file
-			if *savejpg && (strings.EqualFold(filepath.Ext(files[i]), ".JPG") || strings.EqualFold(filepath.Ext(files[i]), ".JPEG")) {
-				source, err := os.Open(tmpFile)
-				if err != nil {
-					log.Printf("Unable to open %s for copy - %s\n", files[i], err.Error())
-					break
-				}
-				defer source.Close()
-				destination, err := ioutil.TempFile(os.Getenv("HOME")+"/photos/", strings.Replace(strings.Replace(timestamps[i]+".*.jpg", "/", "_", -1), " ", "_", -1))
-				if err != nil {
-					log.Printf("Unable to open %s for copy - %s\n", os.Getenv("HOME")+"/photos/"+timestamps[i]+".*.jpg", err.Error())
-					break
-				}
-				_, err = io.Copy(destination, source)
-				if err != nil {
-					log.Printf("Unable to copy %s - %s\n", files[i], err.Error())
-					break
-				}
-				defer destination.Close()
-			}
-		}
+	log.Printf("Camera USB mounted")
 
-		log.Println("Finished download")
+	// list files, sorted by date
+	//
+	type fileStruct struct {
+		fileName string
+		modTime  time.Time
+	}
+	var files []fileStruct
 
-		// wait for queue to complete ... dequeue deletes the files once processed so we need to keep wifi working
-		//
-		close(jobChan)
-		wg.Wait()
-		log.Println("Finished")
+	entries, err := os.ReadDir(path.Join(opts.mount, "DCIM", "MOVIE"))
+	if err != nil {
+		opts.notifier.Notify(notify.Message{Text: cameraTitle(opts.name) + ": unable to list files on USB", Severity: notify.Warning})
+		return err
+	}
+	for _, e := range entries {
+		var file fileStruct
+		fileInfo, _ := e.Info()
+		file.fileName = path.Join(opts.mount, "DCIM", "MOVIE", fileInfo.Name())
+		file.modTime = fileInfo.ModTime()
+		files = append(files, file)
+	}
 
-		// disable bluetooth
-		//
-		disableBluetooth(bluetoothDevice, uuid)
+	entries, err = os.ReadDir(path.Join(opts.mount, "DCIM", "PHOTO"))
+	if err != nil {
+		opts.notifier.Notify(notify.Message{Text: cameraTitle(opts.name) + ": unable to list files on USB", Severity: notify.Warning})
+		return err
+	}
+	for _, e := range entries {
+		var file fileStruct
+		fileInfo, _ := e.Info()
+		file.fileName = path.Join(opts.mount, "DCIM", "PHOTO", fileInfo.Name())
+		file.modTime = fileInfo.ModTime()
+		files = append(files, file)
+	}
 
-		// disconnect wifi
-		//
-		disconnectWifi(nm, activeConnection)
+	// sort by ModTime
+	//
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
 
-		if *memprofile != "" {
-			f, err := os.Create(*memprofile)
-			if err != nil {
-				log.Fatalf("could not create memory profile: %s\n", err)
-			}
-			defer f.Close() // error handling omitted for example
-			runtime.GC()    // get up-to-date statistics
-			if err := pprof.WriteHeapProfile(f); err != nil {
-				log.Fatalf("could not write memory profile: %s\n", err)
-			}
-		}
+	log.Printf("%d files on camera\n", len(files))
+
+	opts.notifier.Notify(notify.Message{
+		Text:   cameraTitle(opts.name) + ": USB connected " + strconv.Itoa(len(files)) + " files to download",
+		Status: &notify.Status{Run: runID, Camera: opts.name, Battery: -1, Files: len(files)},
+	})
+
+	var pictures []Picture
+	for _, file := range files {
+		pictures = append(pictures, Picture{fileName: file.fileName, tmpFilename: file.fileName, timeStamp: file.modTime.String(), camera: opts.name, run: runID, battery: -1})
+	}
+
+	stages := localStages(opts.savejpg, opts.notifier)
+	stages.router, stages.archive, stages.stillOnly = opts.router, opts.archive, opts.stillOnly
+	stages.digest = newDigest(opts.digestTop, opts.digestMontage, opts.detect.labelCutoff())
+	runPipeline(ctx, pictures, opts.pipeline, stages, &opts.limits)
+
+	log.Println("Finished")
+
+	return nil
+}
+
+// wait between connection attempts, false if ctx is done first
+func retryWait(ctx context.Context, wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
 
-// process work in a queue
-func worker(jobChan <-chan Picture, hostname string, signalUser *string, signalRecipient *string, signalGroup *string, limits *int, undeletedPath string, maxFiles int) {
-	defer wg.Done()
+// enable the camera WiFi over bluetooth, then download and process files
+func runCamera(ctx context.Context, opts *options, device discoveredCamera, name string, runID string) error {
 
-	var undeletedFile *os.File = nil
 	var err error
-	var fileCount int = 1
+	var bluetoothDevice *bluetooth.Device
+	var bluetoothAdress string
+
+	exactAddress := "^" + regexp.QuoteMeta(device.address) + "$"
+	address := &exactAddress
+	uuid := &opts.uuid
+	ssid := &opts.ssid
+	password := &opts.password
 
-	if len(undeletedPath) > 0 {
-		undeletedFile, err = os.OpenFile(undeletedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// enable wifi via bluetooth command
+	//
+	for attempt := 1; attempt < 10; attempt++ {
+		bluetoothDevice, bluetoothAdress, err = connectBluetooth(address)
 		if err != nil {
-			log.Printf("Unable to open undeleted file - %s\n", err.Error())
-			undeletedFile = nil
+			log.Printf("Bluetooth connect failed [%d of 10] - %s\n", attempt, string(err.Error()))
+			if bluetoothDevice != nil {
+				disableBluetooth(bluetoothDevice, uuid)
+			}
+			// wait a bit betwwen attempts
+			//
+			if !retryWait(ctx, 2*time.Second) {
+				break
+			}
 		} else {
-			defer undeletedFile.Close()
+			break
 		}
 	}
+	if err != nil {
+		if bluetoothDevice != nil {
+			disableBluetooth(bluetoothDevice, uuid)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		opts.notifier.Notify(notify.Message{Text: cameraTitle(name) + ": unable to connect via bluetooth", Severity: notify.Warning})
+		return err
+	}
+	for attempt := 1; attempt < 10; attempt++ {
+		err = enableWifi(bluetoothDevice, uuid)
+		if err != nil {
+			log.Printf("Enable WiFi failed [%d of 10] - %s\n", attempt, string(err.Error()))
+		} else {
+			break
+		}
+		if !retryWait(ctx, 2*time.Second) {
+			break
+		}
+	}
+	if err != nil {
+		disableBluetooth(bluetoothDevice, uuid)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		opts.notifier.Notify(notify.Message{Text: cameraTitle(name) + ": unable to connect via WiFi", Severity: notify.Warning})
+		return err
+	}
 
-	for picture := range jobChan {
+	if ctx.Err() != nil {
+		disableBluetooth(bluetoothDevice, uuid)
+		return ctx.Err()
+	}
 
-		if modelLoaded {
-			outputfileName, description, _, err := objectDetect(&picture.tmpFilename, limits, false)
-			if err != nil {
-				log.Println(err.Error())
-				err = alert(signalUser, signalRecipient, signalGroup, picture.timeStamp, picture.tmpFilename)
-				os.Remove(picture.tmpFilename)
-			} else {
-				if len(*description) > 0 {
-					message := fmt.Sprintf("[%d of %d] %s description: %s", fileCount, maxFiles, picture.timeStamp, *description)
-					err = alert(signalUser, signalRecipient, signalGroup, message, picture.tmpFilename+" "+*outputfileName)
-				} else {
-					message := fmt.Sprintf("[%d of %d] %s", fileCount, maxFiles, picture.timeStamp)
-					err = alert(signalUser, signalRecipient, signalGroup, message, picture.tmpFilename)
-				}
-				os.Remove(picture.tmpFilename)
-				os.Remove(*outputfileName)
+	// connect to wifi - loop and wait
+	//
+	var hostname string
+	var nm gonetworkmanager.NetworkManager
+	var activeConnection gonetworkmanager.ActiveConnection
+
+	for attempt := 1; attempt < 10; attempt++ {
+		nm, activeConnection, hostname, err = connectWifi(ssid, password)
+		if err != nil {
+			log.Printf("WiFi connect failed [%d of 10] - %s", attempt, string(err.Error()))
+			if activeConnection != nil {
+				disableBluetooth(bluetoothDevice, uuid)
+				disconnectWifi(nm, activeConnection)
 			}
-			if err != nil {
-				log.Println(err.Error())
-			} else {
-				// all good, can now delete on camera
-				//
-				err = delete(picture.fileName, hostname)
-				if err != nil {
-					log.Println("Failed to delete " + picture.fileName + " - " + err.Error())
-					if undeletedFile != nil {
-						if _, err := undeletedFile.WriteString(picture.fileName + "\n"); err != nil {
-							log.Println("Unable to write to undeleted file - ", err.Error())
-						}
-						undeletedFile.Sync()
-					}
-				}
+			// wait a bit betwwen attempts
+			//
+			if !retryWait(ctx, 2*time.Second) {
+				break
 			}
 		} else {
-			// no object detection
-			//
-			message := fmt.Sprintf("[%d of %d] %s", fileCount, maxFiles, picture.timeStamp)
-			err = alert(signalUser, signalRecipient, signalGroup, message, picture.tmpFilename)
-			os.Remove(picture.tmpFilename)
-			if err != nil {
-				log.Println(err.Error())
-			} else {
-				err := delete(picture.fileName, hostname)
-				if err != nil {
-					log.Println("Failed to delete " + picture.fileName + " - " + err.Error())
-					if undeletedFile != nil {
-						if _, err := undeletedFile.WriteString(picture.fileName + "\n"); err != nil {
-							log.Println("Unable to write to undeleted file - ", err.Error())
-						}
-						undeletedFile.Sync()
-					}
-				}
+			break
+		}
+	}
+	if err != nil {
+		if activeConnection != nil {
+			disableBluetooth(bluetoothDevice, uuid)
+			disconnectWifi(nm, activeConnection)
+		}
+
+		// stopping, so still turn off the camera WiFi
+		//
+		if ctx.Err() != nil {
+			if activeConnection == nil {
+				disableBluetooth(bluetoothDevice, uuid)
 			}
+			return ctx.Err()
 		}
 
-		fileCount = fileCount + 1
+		// wifi failed ... so some diagnostics
+		//
+		log.Println("WiFi connection failed")
+
+		log.Println("nmcli general status")
+		cmd := exec.Command("nmcli", "general", "status")
+		stdout, _ := cmd.CombinedOutput()
+		log.Println(string(stdout[:]))
+		log.Println("nmcli connection show")
+		cmd = exec.Command("nmcli", "connection", "show")
+		stdout, _ = cmd.CombinedOutput()
+		log.Println(string(stdout[:]))
+		log.Println("nmcli device status")
+		cmd = exec.Command("nmcli", "device", "status")
+		stdout, _ = cmd.CombinedOutput()
+		log.Println(string(stdout[:]))
+		log.Println("nmcli dev wifi list")
+		cmd = exec.Command("nmcli", "dev", "wifi", "list")
+		stdout, _ = cmd.CombinedOutput()
+		log.Println(string(stdout[:]))
+
+		return err
 	}
-}
 
-// process work in a queue (local USB)
-func workerLocal(jobChan <-chan Picture, signalUser *string, signalRecipient *string, signalGroup *string, limits *int, maxFiles int) {
-	defer wg.Done()
+	client := camera.NewClient(hostname)
+	client.Retries = opts.retries
 
-	var err error
-	var fileCount int = 1
+	// get camera status
+	//
+	// -1 when unknown
+	//
+	battery, err := status(client)
+	if err != nil {
+		battery = -1
+	}
 
-	for picture := range jobChan {
+	var undeletedPath string = ""
 
-		if modelLoaded {
-			outputfileName, description, _, err := objectDetect(&picture.tmpFilename, limits, false)
+	// delete any old pictures first
+	//
+	if opts.undeletedfiles {
+		undeletedPath = os.Getenv("HOME") + "/.undeleted-" + bluetoothAdress
+		if _, err := os.Stat(undeletedPath); err == nil {
+			// keep any that still fail to delete, unless the camera says they have gone
+			//
+			var stillUndeleted []string
+			file, err := os.Open(undeletedPath)
 			if err != nil {
-				log.Println(err.Error())
-				err = alert(signalUser, signalRecipient, signalGroup, picture.timeStamp, picture.tmpFilename)
+				log.Printf("Unable to open undeleted file - %s\n", err.Error())
 			} else {
-				if len(*description) > 0 {
-					message := fmt.Sprintf("[%d of %d] %s description: %s", fileCount, maxFiles, picture.timeStamp, *description)
-					err = alert(signalUser, signalRecipient, signalGroup, message, picture.tmpFilename+" "+*outputfileName)
-				} else {
-					message := fmt.Sprintf("[%d of %d] %s", fileCount, maxFiles, picture.timeStamp)
-					err = alert(signalUser, signalRecipient, signalGroup, message, picture.tmpFilename)
+				defer file.Close()
+				scanner := bufio.NewScanner(file)
+				for scanner.Scan() {
+					err := deleteFile(scanner.Text(), client)
+					if err != nil {
+						if camera.IsNoFile(err) {
+							log.Printf("%s already deleted\n", scanner.Text())
+						} else {
+							log.Println("Failed to delete " + scanner.Text() + " - " + err.Error())
+							stillUndeleted = append(stillUndeleted, scanner.Text())
+						}
+					}
 				}
-			}
-			if err != nil {
-				log.Println(err.Error())
-			} else {
-				// all good, can now delete on camera
-				//
-				err = os.Remove(picture.fileName)
-				if err != nil {
-					log.Println("Failed to delete " + picture.fileName + " - " + err.Error())
+				if err := scanner.Err(); err != nil {
+					log.Printf("Unable to read undeleted file - %s\n", err.Error())
 				}
+				file.Close()
 			}
-		} else {
-			// no object detection
-			//
-			message := fmt.Sprintf("[%d of %d] %s", fileCount, maxFiles, picture.timeStamp)
-			err = alert(signalUser, signalRecipient, signalGroup, message, picture.tmpFilename)
-			if err != nil {
-				log.Println(err.Error())
-			} else {
-				err = os.Remove(picture.fileName)
+			os.Remove(undeletedPath)
+			if len(stillUndeleted) > 0 {
+				err = ioutil.WriteFile(undeletedPath, []byte(strings.Join(stillUndeleted, "\n")+"\n"), 0644)
 				if err != nil {
-					log.Println("Failed to delete " + picture.fileName + " - " + err.Error())
+					log.Printf("Unable to write undeleted file - %s\n", err.Error())
 				}
 			}
 		}
+	}
 
-		fileCount = fileCount + 1
+	// download any new pictures
+	//
+	files, err := listFiles(client)
+	if err != nil {
+		if activeConnection != nil {
+			disableBluetooth(bluetoothDevice, uuid)
+			disconnectWifi(nm, activeConnection)
+		}
+		opts.notifier.Notify(notify.Message{Text: cameraTitle(name) + ": unable to download files", Severity: notify.Warning})
+		return err
+	}
+
+	cameraStatus := &notify.Status{Run: runID, Camera: name, Battery: battery, Files: len(files)}
+	if battery < 0 {
+		opts.notifier.Notify(notify.Message{
+			Text:   cameraTitle(name) + ": battery unknown, " + strconv.Itoa(len(files)) + " files to download",
+			Status: cameraStatus,
+		})
+	} else if battery <= 20 {
+		opts.notifier.Notify(notify.Message{
+			Text:     cameraTitle(name) + ": battery low at " + strconv.Itoa(battery) + "%, " + strconv.Itoa(len(files)) + " files to download",
+			Severity: notify.Warning,
+			Status:   cameraStatus,
+		})
+	} else if battery > 100 {
+		opts.notifier.Notify(notify.Message{
+			Text:   cameraTitle(name) + ": battery charging, " + strconv.Itoa(len(files)) + " files to download",
+			Status: cameraStatus,
+		})
+	} else {
+		opts.notifier.Notify(notify.Message{
+			Text:   cameraTitle(name) + ": battery at " + strconv.Itoa(battery) + "%, " + strconv.Itoa(len(files)) + " files to download",
+			Status: cameraStatus,
+		})
+	}
+
+	var pictures []Picture
+	for _, file := range files {
+		pictures = append(pictures, Picture{fileName: file.FPath, timeStamp: file.Time, file: file, camera: name, run: runID, battery: battery})
 	}
+
+	undeletedList := openUndeletedList(undeletedPath)
+
+	// deletes happen once processed so we need to keep wifi working until the pipeline completes
+	//
+	stages := cameraStages(client, opts.savejpg, undeletedList, opts.notifier)
+	stages.router, stages.archive, stages.stillOnly = opts.router, opts.archive, opts.stillOnly
+	stages.digest = newDigest(opts.digestTop, opts.digestMontage, opts.detect.labelCutoff())
+	runPipeline(ctx, pictures, opts.pipeline, stages, &opts.limits)
+
+	undeletedList.close()
+	log.Println("Finished")
+
+	// disable bluetooth
+	//
+	disableBluetooth(bluetoothDevice, uuid)
+
+	// disconnect wifi
+	//
+	disconnectWifi(nm, activeConnection)
+
+	return nil
 }
 
-// send an alert via signal
-func alert(signalUser *string, signalRecipient *string, signalGroup *string, message string, attachments string) error {
-	if (len(*signalUser) > 0) && (len(*signalGroup) > 0 || len(*signalRecipient) > 0) {
+// Enable bluetooth, once only when running as a daemon
+func enableBluetooth() error {
 
-		// keep signal happy
-		//
-		// better to do this from cron
-		//
-		//cmd := exec.Command("signal-cli", "-u", *signalUser, "receive")
-		//stdout, err := cmd.CombinedOutput()
-		//if err != nil {
-		//	return errors.New("signal-cli failed - " + string(stdout))
-		//}
-		//log.Println(string(stdout[:]))
-
-		var args []string
-		args = append(args, "-u")
-		args = append(args, *signalUser)
-		args = append(args, "send")
-		if len(*signalGroup) > 0 {
-			args = append(args, "-g")
-			args = append(args, *signalGroup)
-		} else {
-			args = append(args, strings.Split(*signalRecipient, " ")...)
+	if !bluetoothEnabled {
+		log.Println("Enabling bluetooth")
+		err := adapter.Enable()
+		if err != nil {
+			return errors.New("failed to enable bluetooth - " + err.Error())
 		}
-		if len(message) > 0 {
-			args = append(args, "-m")
-			args = append(args, message)
+		bluetoothEnabled = true
+	}
+	return nil
+}
+
+// a camera found by bluetooth scan, with the settings for it
+type discoveredCamera struct {
+	address   string
+	localName string
+	opts      *options
+}
+
+// cameras that no device was discovered for
+func undiscovered(cameras []options, devices []discoveredCamera) []*options {
+	var missing []*options
+	for i := range cameras {
+		found := false
+		for _, device := range devices {
+			if device.opts == &cameras[i] {
+				found = true
+				break
+			}
 		}
-		if len(attachments) > 0 {
-			args = append(args, "-a")
-			args = append(args, strings.Split(attachments, " ")...)
+		if !found {
+			missing = append(missing, &cameras[i])
 		}
-		log.Printf("signal-cli %v\n", args)
-		cmd := exec.Command("signal-cli", args...)
+	}
+	return missing
+}
 
-		stdout, err := cmd.CombinedOutput()
-		if err != nil {
-			return errors.New("signal-cli failed - " + string(stdout))
+// scan bluetooth for every device matching a camera address
+func discoverCameras(cameras []options) ([]discoveredCamera, error) {
+
+	err := enableBluetooth()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var discovered []discoveredCamera
+	found := make(map[string]bool)
+
+	// long enough for the slowest camera
+	//
+	scanTime := cameras[0].scanTime
+	for i := range cameras {
+		if cameras[i].scanTime > scanTime {
+			scanTime = cameras[i].scanTime
 		}
 	}
+	log.Printf("Scanning bluetooth for cameras for %s\n", scanTime)
+	timer := time.AfterFunc(scanTime, func() {
+		adapter.StopScan()
+	})
+	defer timer.Stop()
 
-	return nil
+	err = adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		address := result.Address.String()
+		if found[address] {
+			return
+		}
+		for i := range cameras {
+			match, _ := regexp.MatchString(cameras[i].address, address)
+			if match {
+				log.Printf("Found camera: %s %s\n", address, result.LocalName())
+				found[address] = true
+				discovered = append(discovered, discoveredCamera{address: address, localName: result.LocalName(), opts: &cameras[i]})
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, errors.New("failed to complete bluetooth scan - " + err.Error())
+	}
+
+	return discovered, nil
 }
 
 // Enable and connect to bluetooth device
 func connectBluetooth(address *string) (*bluetooth.Device, string, error) {
 
-	// Enable bluetooth
-	//
-	log.Println("Enabling bluetooth")
-	err := adapter.Enable()
+	err := enableBluetooth()
 	if err != nil {
-		return nil, "", errors.New("failed to enable bluetooth - " + err.Error())
+		return nil, "", err
 	}
 
 	ch := make(chan bluetooth.ScanResult, 1)
@@ -808,147 +1200,65 @@ func disconnectWifi(nm gonetworkmanager.NetworkManager, activeConnection gonetwo
 	return nil
 }
 
-type File struct {
-	XMLName  xml.Name `xml:"File"`
-	Name     string   `xml:"NAME"`
-	FPath    string   `xml:"FPATH"`
-	Size     string   `xml:"SIZE"`
-	Timecode string   `xml:"TIMECODE"`
-	Time     string   `xml:"TIME"`
-	Attr     string   `xml:"ATTR"`
-}
-
-type AllFile struct {
-	XMLName xml.Name `xml:"ALLFile"`
-	Files   []File   `xml:"File"`
-}
-
-type List struct {
-	XMLName xml.Name `xml:"LIST"`
-	Allfile AllFile  `xml:"ALLFile"`
-}
-
 // list files on camera sorted by date
-func listFiles(hostname string) ([]string, []string, error) {
-
-	var files []File
-
-	for mode := 0; mode < 2; mode++ {
-
-		// switch mode
-		//
-		_, err := http.Get("http://" + hostname + "/?custom=1&cmd=3001&par=" + strconv.Itoa(mode))
-		if err != nil {
-			return nil, nil, errors.New("unable to get camera mode set page - " + err.Error())
-		}
-
-		// get xml index
-		//
-		resp, err := http.Get("http://" + hostname + "/?custom=1&cmd=3015")
-		if err != nil {
-			return nil, nil, errors.New("unable to get camera index page - " + err.Error())
-		}
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, nil, errors.New("unable to get camera index page - " + err.Error())
-		}
-
-		// parse xml into new slice
-		//
-		var list List
-		err = xml.Unmarshal(body, &list)
-		if err != nil {
-			return nil, nil, errors.New("unable to parse index xml - " + err.Error())
-		}
-		if list.Allfile.Files != nil {
-			for i := 0; i < len(list.Allfile.Files); i++ {
-				files = append(files, list.Allfile.Files[i])
-			}
-		}
-	}
+func listFiles(client *camera.Client) ([]camera.File, error) {
 
-	// sort slice by timecode
-	//
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Timecode < files[j].Timecode
-	})
-
-	var sortedFiles []string
-	var sortedTimestamps []string
-	for _, file := range files {
-		sortedFiles = append(sortedFiles, file.FPath)
-		sortedTimestamps = append(sortedTimestamps, file.Time)
+	files, err := client.List()
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("%d files on camera\n", len(sortedFiles))
+	log.Printf("%d files on camera\n", len(files))
 
-	return sortedFiles, sortedTimestamps, nil
+	return files, nil
 }
 
-// download a file
-func download(file string, hostname string) (string, error) {
-
-	url := "http://" + hostname + strings.ReplaceAll(file, "\\", "/")[2:]
+// download a file, checking it matches the size in the camera index
+func download(file camera.File, client *camera.Client) (string, error) {
 
-	log.Printf("Downloading %s\n", url)
+	log.Printf("Downloading %s\n", client.URL(file.FPath))
 
-	tmpFile, err := ioutil.TempFile("", "image.*"+filepath.Ext(file))
+	tmpFile, err := ioutil.TempFile("", "image.*"+filepath.Ext(file.FPath))
 	if err != nil {
 		return "", errors.New("unable to download file - " + err.Error())
 	}
 	defer tmpFile.Close()
 
-	resp, err := http.Get(url)
+	_, err = client.DownloadFile(file, tmpFile)
 	if err != nil {
-		return tmpFile.Name(), errors.New("unable to download file - " + err.Error())
-	}
-	defer resp.Body.Close()
-
-	_, err = io.Copy(tmpFile, resp.Body)
-	if err != nil {
-		return tmpFile.Name(), errors.New("unable to download file - " + err.Error())
+		return tmpFile.Name(), err
 	}
 
 	return tmpFile.Name(), nil
 }
 
 // delete a file
-func delete(file string, hostname string) error {
+func deleteFile(file string, client *camera.Client) error {
 
-	_, err := http.Get("http://" + hostname + "/?custom=1&cmd=4003&str=" + file)
+	err := client.Delete(file)
 	if err != nil {
-		return errors.New("unable to delete file - " + err.Error())
+		return err
 	}
 	log.Printf("Deleted %s\n", file)
 
 	return nil
 }
 
-type Function struct {
-	XMLName xml.Name `xml:"Function"`
-	Cmd     string   `xml:"Cmd"`
-	Status  string   `xml:"Status"`
-	Value   string   `xml:"Value"`
-}
-
 // get status
-func status(hostname string) (int, error) {
-
-	var battery int
+func status(client *camera.Client) (int, error) {
 
 	// set date
 	//
 	currentTime := time.Now()
 	date := currentTime.Format("2006-01-02")
-	_, err := http.Get("http://" + hostname + "/?custom=1&cmd=3005&str=" + date)
+	err := client.SetDate(currentTime)
 	if err != nil {
 		log.Printf("Unable to set date to %s - %s\n", date, err.Error())
 	} else {
 		log.Printf("Date set to %s\n", date)
 	}
 	time := currentTime.Format("15:04:05")
-	_, err = http.Get("http://" + hostname + "/?custom=1&cmd=3006&str=" + time)
+	err = client.SetTime(currentTime)
 	if err != nil {
 		log.Printf("Unable to set time to %s - %s\n", time, err.Error())
 	} else {
@@ -957,23 +1267,12 @@ func status(hostname string) (int, error) {
 
 	// battery level (?)
 	//
-	resp, err := http.Get("http://" + hostname + "/?custom=1&cmd=3019")
+	battery, err := client.Battery()
 	if err != nil {
-		log.Printf("Unable to get 3019 - %s\n", err.Error())
-	} else {
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err == nil {
-			var function Function
-			err = xml.Unmarshal(body, &function)
-			if err != nil {
-				log.Printf("unable to parse 3019 xml - %s\n", err.Error())
-			} else {
-				battery, _ = strconv.Atoi(function.Value)
-				log.Printf("Battery at %s%%\n", function.Value)
-			}
-		}
+		log.Printf("Unable to get battery level - %s\n", err.Error())
+		return -1, err
 	}
+	log.Printf("Battery at %d%%\n", battery)
 
 	return battery, nil
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plord12/trailcameradownload/camera"
+	"github.com/plord12/trailcameradownload/camera/cameratest"
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/notify"
+)
+
+// notifier that records messages
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notify.Message
+	err      error
+}
+
+func (r *recordingNotifier) Notify(message notify.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message)
+	return r.err
+}
+
+func TestDownloadAndDelete(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	now := time.Now()
+	server.AddPhoto("IM_00001.JPG", []byte("photo"), now)
+	server.AddMovie("VD_00001.MP4", []byte("movie"), now.Add(time.Minute))
+
+	client := camera.NewClient(server.Hostname())
+
+	files, err := listFiles(client)
+	if err != nil {
+		t.Fatalf("failed to list files - %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+
+	var pictures []Picture
+	for _, file := range files {
+		pictures = append(pictures, Picture{fileName: file.FPath, timeStamp: file.Time, file: file})
+	}
+
+	notifier := &recordingNotifier{}
+	limits := 5
+	config := pipelineConfig{downloaders: 2, detectors: 2, notifiers: 1, queue: 1}
+	runPipeline(context.Background(), pictures, config, cameraStages(client, false, nil, notifier), &limits)
+
+	if len(notifier.messages) != 2 {
+		t.Errorf("expected 2 alerts, got %v", notifier.messages)
+	}
+	if remaining := server.Files(); len(remaining) != 0 {
+		t.Errorf("files not deleted from camera - %v", remaining)
+	}
+	for _, message := range notifier.messages {
+		for _, attachment := range message.Attachments {
+			if _, err := os.Stat(attachment); err == nil {
+				t.Errorf("%s not removed", attachment)
+				os.Remove(attachment)
+			}
+		}
+	}
+}
+
+func TestFailedAlert(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	file := server.AddPhoto("IM_00001.JPG", []byte("photo"), time.Now())
+
+	client := camera.NewClient(server.Hostname())
+
+	// nothing deleted unless notified
+	limits := 5
+	config := pipelineConfig{downloaders: 1, detectors: 1, notifiers: 1, queue: 1}
+	runPipeline(context.Background(), []Picture{{fileName: file.FPath, timeStamp: file.Time, file: file}}, config, cameraStages(client, false, nil, &recordingNotifier{err: errors.New("alert failed")}), &limits)
+
+	if len(server.Files()) != 1 {
+		t.Errorf("file deleted without notification")
+	}
+}
+
+func TestTruncatedDownload(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	file := server.AddMovie("VD_00001.MP4", []byte("movie data"), time.Now())
+	server.Truncate(file.FPath, 5)
+
+	client := camera.NewClient(server.Hostname())
+	client.Backoff = time.Millisecond
+
+	tmpFile, err := download(file, client)
+	os.Remove(tmpFile)
+	var sizeErr *camera.SizeError
+	if !errors.As(err, &sizeErr) {
+		t.Errorf("expected size error, got %v", err)
+	}
+	if len(server.Files()) != 1 {
+		t.Errorf("truncated file deleted from camera")
+	}
+}
+
+func TestAlertFiles(t *testing.T) {
+
+	files := []string{"VD_00001.MP4", "detected.mp4"}
+	tests := []struct {
+		result    *detection.Result
+		stillOnly bool
+		expected  []string
+	}{
+		{nil, false, files},
+		{&detection.Result{Output: "detected.mp4"}, true, files},
+		{&detection.Result{Output: "detected.mp4", Still: "still.jpg"}, false, []string{"still.jpg", "VD_00001.MP4", "detected.mp4"}},
+		{&detection.Result{Output: "detected.mp4", Still: "still.jpg", Preview: "preview.gif"}, false, []string{"still.jpg", "preview.gif"}},
+		{&detection.Result{Output: "detected.mp4", Still: "still.jpg", Preview: "preview.gif"}, true, []string{"still.jpg"}},
+	}
+	for _, test := range tests {
+		picture := Picture{result: test.result}
+		if attachments := picture.alertFiles(files, test.stillOnly); !reflect.DeepEqual(attachments, test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, attachments)
+		}
+	}
+}
+
+func TestClassifies(t *testing.T) {
+
+	all := detectOptions{}
+	tits := detectOptions{classify: "Great_Tit, Blue_Tit"}
+	if !all.classifies("Red_Fox") || !tits.classifies("Blue_Tit") || tits.classifies("Red_Fox") {
+		t.Errorf("unexpected labels classified")
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+
+	if !retryWait(context.Background(), time.Millisecond) {
+		t.Errorf("expected to wait")
+	}
+
+	// stopping ends the wait at once
+	//
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if retryWait(ctx, time.Minute) || time.Since(start) > time.Second {
+		t.Errorf("expected wait to stop")
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+
+	saved := labels
+	defer func() { labels = saved }()
+
+	// nothing to check against until a model is loaded
+	//
+	opts := &options{}
+	labels = nil
+	checkLabels(opts)
+	if opts.labelsChecked {
+		t.Errorf("expected no check without labels")
+	}
+
+	labels = []string{"Red_Fox"}
+	checkLabels(opts)
+	if !opts.labelsChecked {
+		t.Errorf("expected labels to be checked")
+	}
+}
+
+func TestUndiscovered(t *testing.T) {
+
+	cameras := []options{{name: "garden"}, {name: "pond"}, {name: "wood"}}
+	devices := []discoveredCamera{{address: "a", opts: &cameras[2]}, {address: "b", opts: &cameras[0]}}
+	missing := undiscovered(cameras, devices)
+	if len(missing) != 1 || missing[0] != &cameras[1] {
+		t.Errorf("expected pond to be missing, got %v", missing)
+	}
+	if len(undiscovered(cameras, nil)) != 3 {
+		t.Errorf("expected all cameras missing")
+	}
+}
+
+func TestStatusBattery(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+	client := camera.NewClient(server.Hostname())
+
+	server.SetBattery(75)
+	if battery, err := status(client); err != nil || battery != 75 {
+		t.Errorf("expected battery at 75%%, got %d - %v", battery, err)
+	}
+
+	// unknown rather than empty
+	//
+	server.FailCommand(camera.CmdBattery, camera.StatusUnknownCommand)
+	if battery, err := status(client); err == nil || battery != -1 {
+		t.Errorf("expected unknown battery and error, got %d - %v", battery, err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package montage builds contact sheets of images with captions.
+package montage
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Tile is one image in a contact sheet, with caption lines below it
+type Tile struct {
+	Image   image.Image
+	Caption []string
+}
+
+// Sheet lays tiles out in Columns, each scaled to Width pixels wide
+type Sheet struct {
+	Columns int
+	Width   int
+	Spacing int
+}
+
+// DefaultSheet is four columns of 1024 pixel wide images
+var DefaultSheet = Sheet{Columns: 4, Width: 1024, Spacing: 4}
+
+var (
+	background = color.RGBA{0x20, 0x20, 0x20, 0xff}
+	foreground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// Draw builds the contact sheet, left to right then top to bottom
+func (s Sheet) Draw(tiles []Tile) (image.Image, error) {
+
+	if len(tiles) == 0 {
+		return nil, errors.New("no images for montage")
+	}
+	columns := s.Columns
+	if columns < 1 {
+		columns = 1
+	}
+	if columns > len(tiles) {
+		columns = len(tiles)
+	}
+	width := s.Width
+	if width < 1 {
+		width = DefaultSheet.Width
+	}
+
+	// captions are scaled with the tiles
+	//
+	face, err := captionFace(float64(width) / 40)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	lineHeight := face.Metrics().Height.Ceil()
+
+	// each row is as high as its tallest image and caption
+	//
+	rows := (len(tiles) + columns - 1) / columns
+	heights := make([]int, rows)
+	scaled := make([]image.Rectangle, len(tiles))
+	for i, tile := range tiles {
+		bounds := tile.Image.Bounds()
+		if bounds.Dx() == 0 || bounds.Dy() == 0 {
+			return nil, errors.New("empty image for montage")
+		}
+		scaled[i] = image.Rect(0, 0, width, bounds.Dy()*width/bounds.Dx())
+		height := scaled[i].Dy() + len(tile.Caption)*lineHeight
+		if height > heights[i/columns] {
+			heights[i/columns] = height
+		}
+	}
+
+	sheetHeight := s.Spacing
+	for _, height := range heights {
+		sheetHeight += height + s.Spacing
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, s.Spacing+columns*(width+s.Spacing), sheetHeight))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	y := s.Spacing
+	for row, height := range heights {
+		for column := 0; column < columns; column++ {
+			i := row*columns + column
+			if i >= len(tiles) {
+				break
+			}
+			origin := image.Pt(s.Spacing+column*(width+s.Spacing), y)
+			draw.CatmullRom.Scale(sheet, scaled[i].Add(origin), tiles[i].Image, tiles[i].Image.Bounds(), draw.Over, nil)
+
+			drawer := font.Drawer{Dst: sheet, Src: image.NewUniform(foreground), Face: face}
+			baseline := origin.Y + scaled[i].Dy() + face.Metrics().Ascent.Ceil()
+			for line, caption := range tiles[i].Caption {
+				drawer.Dot = fixed.P(origin.X+lineHeight/4, baseline+line*lineHeight)
+				drawer.DrawString(caption)
+			}
+		}
+		y += height + s.Spacing
+	}
+
+	return sheet, nil
+}
+
+func captionFace(size float64) (font.Face, error) {
+	if size < 10 {
+		size = 10
+	}
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// Load reads an image file
+func Load(fileName string) (image.Image, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, errors.New("unable to decode " + fileName + " - " + err.Error())
+	}
+	return img, nil
+}
+
+// WriteJPEG writes img to fileName as a JPEG
+func WriteJPEG(fileName string, img image.Image) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	err = jpeg.Encode(file, img, &jpeg.Options{Quality: 85})
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,84 @@
+package montage
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func solid(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestDraw(t *testing.T) {
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	tiles := []Tile{
+		{Image: solid(200, 100, red), Caption: []string{"Red Fox 87.5%", "2022/12/06 05:43:40"}},
+		{Image: solid(100, 100, blue), Caption: []string{"Wood Pigeon 60.0%"}},
+		{Image: solid(400, 200, red)},
+	}
+
+	sheet := Sheet{Columns: 2, Width: 100, Spacing: 2}
+	img, err := sheet.Draw(tiles)
+	if err != nil {
+		t.Fatalf("failed to draw - %v", err)
+	}
+
+	// two rows of two columns, each as high as its tallest image and caption
+	//
+	face, _ := captionFace(10)
+	lineHeight := face.Metrics().Height.Ceil()
+	bounds := img.Bounds()
+	if bounds.Dx() != 2+2*(100+2) || bounds.Dy() != 2+100+lineHeight+2+50+2 {
+		t.Errorf("unexpected size %v", bounds)
+	}
+
+	// images are scaled into place
+	//
+	if r, g, b, _ := img.At(2+25, 2+25).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("expected red tile, got %v %v %v", r, g, b)
+	}
+	if r, _, b, _ := img.At(2+102+50, 2+50).RGBA(); r != 0 || b != 0xffff {
+		t.Errorf("expected blue tile, got %v %v", r, b)
+	}
+
+	// captions are drawn in the foreground colour
+	//
+	found := false
+	for y := 2 + 50; y < 2+50+2*lineHeight && !found; y++ {
+		for x := 2; x < 102; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r > 0x8000 && g > 0x8000 && b > 0x8000 {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no caption drawn")
+	}
+
+	fileName := filepath.Join(t.TempDir(), "montage.jpg")
+	if err = WriteJPEG(fileName, img); err != nil {
+		t.Fatalf("failed to write - %v", err)
+	}
+	loaded, err := Load(fileName)
+	if err != nil {
+		t.Fatalf("failed to load - %v", err)
+	}
+	if loaded.Bounds() != bounds {
+		t.Errorf("unexpected loaded size %v", loaded.Bounds())
+	}
+
+	if _, err = sheet.Draw(nil); err == nil {
+		t.Errorf("expected error without tiles")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "image"
+
+// settings for skipping detection on frames without motion
+//
+// a frame moves when at least area of it differs from the background, with
+// crop detection only looks at the moving part
+type motionOptions struct {
+	enabled bool
+	area    float64
+	crop    bool
+}
+
+// part of frame to detect objects in, a square around the moving region with
+// sides of at least minSize, or all the frame if that's nearly as big
+func detectRegion(moving image.Rectangle, frame image.Rectangle, minSize int) image.Rectangle {
+
+	size := moving.Dx()
+	if moving.Dy() > size {
+		size = moving.Dy()
+	}
+	size += size / 2
+	if size < minSize {
+		size = minSize
+	}
+
+	// centred on the movement, moved inside the frame
+	//
+	centre := image.Pt((moving.Min.X+moving.Max.X)/2, (moving.Min.Y+moving.Max.Y)/2)
+	region := image.Rect(centre.X-size/2, centre.Y-size/2, centre.X-size/2+size, centre.Y-size/2+size)
+	if region.Min.X < frame.Min.X {
+		region = region.Add(image.Pt(frame.Min.X-region.Min.X, 0))
+	}
+	if region.Max.X > frame.Max.X {
+		region = region.Add(image.Pt(frame.Max.X-region.Max.X, 0))
+	}
+	if region.Min.Y < frame.Min.Y {
+		region = region.Add(image.Pt(0, frame.Min.Y-region.Min.Y))
+	}
+	if region.Max.Y > frame.Max.Y {
+		region = region.Add(image.Pt(0, frame.Max.Y-region.Max.Y))
+	}
+	region = region.Intersect(frame)
+
+	if region.Dx()*region.Dy()*4 > frame.Dx()*frame.Dy()*3 {
+		return frame
+	}
+	return region
+}
+
+// boxes found in region, as top, left, bottom, right fractions of the region,
+// converted to fractions of frame
+func frameLocs(loc []float32, region image.Rectangle, frame image.Point) []float32 {
+	locs := make([]float32, len(loc))
+	for i := 0; i+3 < len(loc); i += 4 {
+		locs[i] = (float32(region.Min.Y) + loc[i]*float32(region.Dy())) / float32(frame.Y)
+		locs[i+1] = (float32(region.Min.X) + loc[i+1]*float32(region.Dx())) / float32(frame.X)
+		locs[i+2] = (float32(region.Min.Y) + loc[i+2]*float32(region.Dy())) / float32(frame.Y)
+		locs[i+3] = (float32(region.Min.X) + loc[i+3]*float32(region.Dx())) / float32(frame.X)
+	}
+	return locs
+}
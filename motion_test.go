@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestDetectRegion(t *testing.T) {
+
+	frame := image.Rect(0, 0, 1920, 1080)
+	tests := []struct {
+		moving   image.Rectangle
+		expected image.Rectangle
+	}{
+		// square around the movement
+		{image.Rect(900, 400, 1100, 500), image.Rect(850, 300, 1150, 600)},
+		// at least the detector size
+		{image.Rect(1000, 500, 1010, 510), image.Rect(855, 355, 1155, 655)},
+		// moved inside the frame
+		{image.Rect(0, 1000, 100, 1080), image.Rect(0, 780, 300, 1080)},
+		// nearly all the frame
+		{image.Rect(100, 100, 1800, 1000), frame},
+	}
+	for _, test := range tests {
+		if region := detectRegion(test.moving, frame, 300); region != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.moving, test.expected, region)
+		}
+	}
+}
+
+func TestFrameLocs(t *testing.T) {
+
+	// a box over the whole region is the region
+	//
+	locs := frameLocs([]float32{0, 0, 1, 1, 0.5, 0.5, 1, 1}, image.Rect(850, 300, 1150, 600), image.Pt(1920, 1080))
+	expected := []float32{300.0 / 1080, 850.0 / 1920, 600.0 / 1080, 1150.0 / 1920, 450.0 / 1080, 1000.0 / 1920, 600.0 / 1080, 1150.0 / 1920}
+	for i := range expected {
+		if math.Abs(float64(locs[i]-expected[i])) > 1e-6 {
+			t.Errorf("expected %v, got %v", expected, locs)
+			break
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Email sends messages by SMTP, with attached images shown inline if Inline is
+// set
+//
+// the subject is "Trail camera: " followed by the first line of the message
+type Email struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	Inline   bool
+}
+
+// a message with its attachments read
+type emailMessage struct {
+	text        string
+	severity    Severity
+	attachments []emailAttachment
+}
+
+type emailAttachment struct {
+	name string
+	data []byte
+}
+
+// Notify emails message
+func (e *Email) Notify(message Message) error {
+
+	m := emailMessage{text: message.Text, severity: message.Severity}
+	for _, fileName := range message.Attachments {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return errors.New("unable to read attachment - " + err.Error())
+		}
+		m.attachments = append(m.attachments, emailAttachment{name: filepath.Base(fileName), data: data})
+	}
+
+	return e.send(e.subject(message.Text), m)
+}
+
+func (e *Email) subject(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return "Trail camera: " + text
+}
+
+func (e *Email) send(subject string, m emailMessage) error {
+
+	body, err := e.build(subject, m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if len(e.Username) > 0 {
+		host, _, _ := net.SplitHostPort(e.Addr)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	log.Printf("email %q to %v\n", subject, e.To)
+	err = smtp.SendMail(e.Addr, auth, e.From, e.To, body)
+	if err != nil {
+		return errors.New("unable to send email - " + err.Error())
+	}
+	return nil
+}
+
+// build the email
+//
+// the text is followed by inline images in a multipart/related html part,
+// other files are attachments
+func (e *Email) build(subject string, m emailMessage, date time.Time) ([]byte, error) {
+
+	var buf bytes.Buffer
+	mixed := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", e.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	if m.severity == Critical {
+		buf.WriteString("X-Priority: 1\r\nImportance: high\r\n")
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	var inline, attached []emailAttachment
+	for _, a := range m.attachments {
+		if e.Inline && isImage(a.name) {
+			inline = append(inline, a)
+		} else {
+			attached = append(attached, a)
+		}
+	}
+
+	if len(inline) == 0 {
+		err := writePart(mixed, textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(m.text))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var related bytes.Buffer
+		relatedWriter := multipart.NewWriter(&related)
+
+		var page strings.Builder
+		page.WriteString("<html><body>\n")
+		page.WriteString("<p>" + html.EscapeString(m.text) + "</p>\n")
+		for i := range inline {
+			fmt.Fprintf(&page, "<p><img src=\"cid:image%d\" alt=\"%s\" style=\"max-width:100%%\"></p>\n", i, html.EscapeString(inline[i].name))
+		}
+		page.WriteString("</body></html>\n")
+
+		err := writePart(relatedWriter, textproto.MIMEHeader{"Content-Type": {"text/html; charset=utf-8"}}, []byte(page.String()))
+		if err != nil {
+			return nil, err
+		}
+		for i, a := range inline {
+			err = writePart(relatedWriter, textproto.MIMEHeader{
+				"Content-Type":        {contentType(a.name)},
+				"Content-Disposition": {mime.FormatMediaType("inline", map[string]string{"filename": a.name})},
+				"Content-Id":          {fmt.Sprintf("<image%d>", i)},
+			}, a.data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		relatedWriter.Close()
+
+		part, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + relatedWriter.Boundary()}})
+		if err != nil {
+			return nil, err
+		}
+		part.Write(related.Bytes())
+	}
+
+	for _, a := range attached {
+		err := writePart(mixed, textproto.MIMEHeader{
+			"Content-Type":        {contentType(a.name)},
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": a.name})},
+		}, a.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	mixed.Close()
+
+	return buf.Bytes(), nil
+}
+
+// write a base64 encoded part
+func writePart(w *multipart.Writer, header textproto.MIMEHeader, data []byte) error {
+	header.Set("Content-Transfer-Encoding", "base64")
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		part.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+func isImage(fileName string) bool {
+	return strings.HasPrefix(contentType(fileName), "image/")
+}
+
+func contentType(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext == ".mp4" {
+		return "video/mp4"
+	}
+	t := mime.TypeByExtension(ext)
+	if len(t) == 0 {
+		return "application/octet-stream"
+	}
+	return t
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"bufio"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stand-in SMTP server, keeping each email received
+type fakeSMTP struct {
+	listener net.Listener
+	mu       sync.Mutex
+	emails   []string
+	rcpt     [][]string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.emails...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	var rcpt []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT"):
+			rcpt = append(rcpt, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			reply("250 OK")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err = reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.emails = append(s.emails, data.String())
+			s.rcpt = append(s.rcpt, rcpt)
+			s.mu.Unlock()
+			rcpt = nil
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// the parts of an email, by content type, recursing into multipart parts
+func emailParts(t *testing.T, email string) (*mail.Message, map[string][]*multipart.Part) {
+	msg, err := mail.ReadMessage(strings.NewReader(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string][]*multipart.Part)
+	var walk func(body *multipart.Reader)
+	walk = func(body *multipart.Reader) {
+		for {
+			part, err := body.NextPart()
+			if err != nil {
+				return
+			}
+			mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if strings.HasPrefix(mediaType, "multipart/") {
+				walk(multipart.NewReader(part, params["boundary"]))
+				continue
+			}
+			ioutil.ReadAll(part)
+			parts[mediaType] = append(parts[mediaType], part)
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected content type %s", msg.Header.Get("Content-Type"))
+	}
+	walk(multipart.NewReader(msg.Body, params["boundary"]))
+	return msg, parts
+}
+
+func TestEmail(t *testing.T) {
+	server := newFakeSMTP(t)
+	defer server.listener.Close()
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image.JPG")
+	detected := filepath.Join(dir, "detected.JPG")
+	video := filepath.Join(dir, "detected.MP4")
+	for _, fileName := range []string{image, detected, video} {
+		os.WriteFile(fileName, []byte("data for "+fileName), 0644)
+	}
+
+	e := &Email{Addr: server.listener.Addr().String(), From: "camera@example.com", To: []string{"a@example.com", "b@example.com"}, Inline: true}
+
+	err := e.Notify(Message{Text: "[1 of 2] 2022/12/05 23:43:40 description: Red_Fox (85.4%)", Attachments: []string{image, detected}})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if len(server.sent()) != 1 || strings.Join(server.rcpt[0], " ") != "a@example.com b@example.com" {
+		t.Fatalf("email not sent to recipients %v", server.rcpt)
+	}
+	msg, parts := emailParts(t, server.sent()[0])
+	if msg.Header.Get("Subject") != "Trail camera: [1 of 2] 2022/12/05 23:43:40 description: Red_Fox (85.4%)" {
+		t.Errorf("unexpected subject %s", msg.Header.Get("Subject"))
+	}
+	if len(parts["text/html"]) != 1 || len(parts["image/jpeg"]) != 2 || len(parts["text/plain"]) != 0 {
+		t.Errorf("expected html with two inline images, got %v", parts)
+	}
+	for i, part := range parts["image/jpeg"] {
+		if !strings.HasPrefix(part.Header.Get("Content-Disposition"), "inline") || part.Header.Get("Content-Id") == "" {
+			t.Errorf("image %d not inline", i)
+		}
+	}
+
+	// a video can't be inline
+	//
+	e.Notify(Message{Text: "second", Attachments: []string{image, video}, Severity: Critical})
+	msg, parts = emailParts(t, server.sent()[1])
+	if msg.Header.Get("X-Priority") != "1" {
+		t.Errorf("unexpected headers %v", msg.Header)
+	}
+	if len(parts["image/jpeg"]) != 1 || len(parts["video/mp4"]) != 1 ||
+		!strings.HasPrefix(parts["video/mp4"][0].Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("expected inline image and attached video, got %v", parts)
+	}
+
+	// attachments only
+	//
+	e.Inline = false
+	e.Notify(Message{Text: "hello", Attachments: []string{image}})
+	_, parts = emailParts(t, server.sent()[2])
+	if len(parts["text/plain"]) != 1 || len(parts["image/jpeg"]) != 1 ||
+		!strings.HasPrefix(parts["image/jpeg"][0].Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("expected text with attached image, got %v", parts)
+	}
+
+	if err = e.Notify(Message{Text: "missing", Attachments: []string{filepath.Join(dir, "missing.JPG")}}); err == nil {
+		t.Errorf("expected error for missing attachment")
+	}
+	server.listener.Close()
+	if err = e.Notify(Message{Text: "hello"}); err == nil {
+		t.Errorf("expected error with no server")
+	}
+}
@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/plord12/trailcameradownload/detection"
+)
+
+// MQTT publishes camera status and detections to a broker
+//
+// for each camera, named from the message or Camera, it publishes to :
+//
+//	<Topic>/<camera>/battery    battery level, retained
+//	<Topic>/<camera>/files      files to download, retained
+//	<Topic>/<camera>/species    highest scoring label of the last described capture, retained
+//	<Topic>/<camera>/detection  JSON capture details
+//	<Topic>/<camera>/alert      JSON text of other messages
+//
+// with DiscoveryPrefix set, Home Assistant discovery config for these is
+// published the first time each camera is seen
+type MQTT struct {
+	Client          mqtt.Client
+	Topic           string
+	Camera          string
+	DiscoveryPrefix string
+	QoS             byte
+
+	mu         sync.Mutex
+	discovered map[string]bool
+}
+
+// NewMQTTClient creates a client for broker, for example tcp://localhost:1883,
+// connecting when first used
+func NewMQTTClient(broker string, username string, password string) mqtt.Client {
+	options := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetUsername(username).
+		SetPassword(password).
+		SetConnectTimeout(30 * time.Second).
+		SetAutoReconnect(true)
+	return mqtt.NewClient(options)
+}
+
+type mqttCapture struct {
+	Camera      string                `json:"camera"`
+	File        string                `json:"file"`
+	Time        string                `json:"time"`
+	Description string                `json:"description"`
+	Labels      []detection.Label     `json:"labels"`
+	Detections  []detection.Detection `json:"detections"`
+}
+
+type mqttAlert struct {
+	Camera   string `json:"camera"`
+	Text     string `json:"text"`
+	Severity string `json:"severity"`
+}
+
+// Notify publishes message
+func (m *MQTT) Notify(message Message) error {
+
+	err := m.connect()
+	if err != nil {
+		return err
+	}
+
+	name := m.Camera
+	if message.Capture != nil && len(message.Capture.Camera) > 0 {
+		name = message.Capture.Camera
+	} else if message.Status != nil && len(message.Status.Camera) > 0 {
+		name = message.Status.Camera
+	}
+	base := m.topic() + "/" + topicName(name)
+
+	err = m.discover(name)
+	if err != nil {
+		return err
+	}
+
+	if message.Status != nil {
+		if message.Status.Battery >= 0 {
+			// over 100 means charging
+			//
+			battery := message.Status.Battery
+			if battery > 100 {
+				battery = 100
+			}
+			err = m.publish(base+"/battery", true, []byte(strconv.Itoa(battery)))
+			if err != nil {
+				return err
+			}
+		}
+		return m.publish(base+"/files", true, []byte(strconv.Itoa(message.Status.Files)))
+	}
+
+	if message.Capture != nil {
+		capture := mqttCapture{
+			Camera:      message.Capture.Camera,
+			File:        message.Capture.File,
+			Time:        message.Capture.Time,
+			Description: strings.TrimSpace(message.Capture.Description),
+			Labels:      message.Capture.Labels,
+			Detections:  message.Capture.Detections,
+		}
+		err = m.publishJSON(base+"/detection", false, capture)
+		if err != nil {
+			return err
+		}
+
+		// only labels scoring enough to be described, not noise
+		//
+		if len(capture.Description) > 0 && len(capture.Labels) > 0 {
+			return m.publish(base+"/species", true, []byte(capture.Labels[0].Name))
+		}
+		return nil
+	}
+
+	return m.publishJSON(base+"/alert", false, mqttAlert{Camera: name, Text: message.Text, Severity: message.Severity.String()})
+}
+
+func (m *MQTT) topic() string {
+	if len(m.Topic) == 0 {
+		return "trailcamera"
+	}
+	return strings.TrimSuffix(m.Topic, "/")
+}
+
+func (m *MQTT) connect() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Client.IsConnected() {
+		return nil
+	}
+	token := m.Client.Connect()
+	if !token.WaitTimeout(time.Minute) {
+		return errors.New("unable to connect to MQTT broker - timeout")
+	}
+	if token.Error() != nil {
+		return errors.New("unable to connect to MQTT broker - " + token.Error().Error())
+	}
+	return nil
+}
+
+func (m *MQTT) publish(topic string, retained bool, payload []byte) error {
+	log.Printf("mqtt %s %s\n", topic, payload)
+	token := m.Client.Publish(topic, m.QoS, retained, payload)
+	if !token.WaitTimeout(time.Minute) {
+		return errors.New("unable to publish to " + topic + " - timeout")
+	}
+	if token.Error() != nil {
+		return errors.New("unable to publish to " + topic + " - " + token.Error().Error())
+	}
+	return nil
+}
+
+func (m *MQTT) publishJSON(topic string, retained bool, value interface{}) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return m.publish(topic, retained, payload)
+}
+
+// publish Home Assistant discovery config for a camera
+func (m *MQTT) discover(name string) error {
+
+	if len(m.DiscoveryPrefix) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := "trailcamera_" + topicName(name)
+	if m.discovered[id] {
+		return nil
+	}
+
+	title := "Trail camera"
+	if len(name) > 0 {
+		title = "Trail camera " + name
+	}
+	base := m.topic() + "/" + topicName(name)
+	device := map[string]interface{}{
+		"identifiers": []string{id},
+		"name":        title,
+		"model":       "trailcameradownload",
+	}
+
+	sensors := []map[string]interface{}{
+		{
+			"object_id":           "battery",
+			"name":                title + " battery",
+			"state_topic":         base + "/battery",
+			"device_class":        "battery",
+			"unit_of_measurement": "%",
+		},
+		{
+			"object_id":   "files",
+			"name":        title + " files",
+			"state_topic": base + "/files",
+			"icon":        "mdi:file-multiple",
+		},
+		{
+			"object_id":             "species",
+			"name":                  title + " last species seen",
+			"state_topic":           base + "/species",
+			"json_attributes_topic": base + "/detection",
+			"icon":                  "mdi:paw",
+		},
+	}
+	for _, sensor := range sensors {
+		object := sensor["object_id"].(string)
+		delete(sensor, "object_id")
+		sensor["unique_id"] = id + "_" + object
+		sensor["device"] = device
+		err := m.publishJSON(strings.TrimSuffix(m.DiscoveryPrefix, "/")+"/sensor/"+id+"/"+object+"/config", true, sensor)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.discovered == nil {
+		m.discovered = make(map[string]bool)
+	}
+	m.discovered[id] = true
+	return nil
+}
+
+// a camera name usable in a topic
+func topicName(name string) string {
+	if len(name) == 0 {
+		return "camera"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+}
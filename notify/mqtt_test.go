@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/plord12/trailcameradownload/detection"
+)
+
+// stand-in MQTT broker, keeping each message published
+type fakeBroker struct {
+	listener  net.Listener
+	mu        sync.Mutex
+	published []*packets.PublishPacket
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			packets.NewControlPacket(packets.Connack).Write(conn)
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			b.published = append(b.published, p)
+			b.mu.Unlock()
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				ack.Write(conn)
+			}
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.published)
+}
+
+// retained flag and payload of the last message on each topic
+func (b *fakeBroker) topics() map[string]*packets.PublishPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	topics := make(map[string]*packets.PublishPacket)
+	for _, p := range b.published {
+		topics[p.TopicName] = p
+	}
+	return topics
+}
+
+func TestMQTT(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.listener.Close()
+
+	client := NewMQTTClient("tcp://"+broker.listener.Addr().String(), "", "")
+	defer client.Disconnect(0)
+	m := &MQTT{Client: client, Topic: "home/trailcamera/", DiscoveryPrefix: "homeassistant", QoS: 1}
+
+	err := m.Notify(Message{Text: "battery", Status: &Status{Camera: "Back Garden", Battery: 120, Files: 3}})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	err = m.Notify(Message{Text: "capture", Capture: &Capture{
+		Camera:      "Back Garden",
+		File:        `A:\DCIM\PHOTO\IM_00001.JPG`,
+		Time:        "2022/12/05 23:43:40",
+		Description: " Red Fox (85.4%)",
+		Labels:      []detection.Label{{Name: "Red_Fox", Score: 0.854}},
+		Detections:  []detection.Detection{{Label: "Red_Fox", Score: 0.9, Box: detection.Box{Left: 0.1, Top: 0.2, Right: 0.3, Bottom: 0.4}}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if err = m.Notify(Message{Text: "unable to connect", Severity: Warning}); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	topics := broker.topics()
+	expected := map[string]string{
+		"home/trailcamera/back_garden/battery": "100",
+		"home/trailcamera/back_garden/files":   "3",
+		"home/trailcamera/back_garden/species": "Red_Fox",
+		"home/trailcamera/camera/alert":        `{"camera":"","text":"unable to connect","severity":"warning"}`,
+	}
+	for topic, payload := range expected {
+		if topics[topic] == nil || string(topics[topic].Payload) != payload {
+			t.Errorf("expected %s on %s, got %v", payload, topic, topics[topic])
+		}
+	}
+	if !topics["home/trailcamera/back_garden/battery"].Retain {
+		t.Errorf("battery not retained")
+	}
+
+	var capture mqttCapture
+	if p := topics["home/trailcamera/back_garden/detection"]; p == nil || json.Unmarshal(p.Payload, &capture) != nil {
+		t.Fatalf("no detection published")
+	}
+	if capture.Description != "Red Fox (85.4%)" || len(capture.Detections) != 1 || capture.Detections[0].Box.Bottom != 0.4 {
+		t.Errorf("unexpected detection %+v", capture)
+	}
+
+	var config map[string]interface{}
+	if p := topics["homeassistant/sensor/trailcamera_back_garden/battery/config"]; p == nil || json.Unmarshal(p.Payload, &config) != nil || !p.Retain {
+		t.Fatalf("no battery discovery published")
+	}
+	if config["state_topic"] != "home/trailcamera/back_garden/battery" || config["unique_id"] != "trailcamera_back_garden_battery" {
+		t.Errorf("unexpected discovery %v", config)
+	}
+	if topics["homeassistant/sensor/trailcamera_back_garden/species/config"] == nil {
+		t.Errorf("no species discovery published")
+	}
+
+	// discovery only once per camera
+	//
+	count := broker.count()
+	m.Notify(Message{Text: "battery", Status: &Status{Camera: "Back Garden", Battery: -1, Files: 0}})
+	if len(broker.topics()) != len(topics) || broker.count() != count+1 {
+		t.Errorf("unexpected messages published")
+	}
+
+	// too faint to be described, so not a species seen
+	//
+	err = m.Notify(Message{Text: "capture", Capture: &Capture{
+		Camera: "Back Garden",
+		File:   `A:\DCIM\PHOTO\IM_00002.JPG`,
+		Labels: []detection.Label{{Name: "Person", Score: 0.05}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	if p := broker.topics()["home/trailcamera/back_garden/species"]; p == nil || string(p.Payload) != "Red_Fox" {
+		t.Errorf("expected species to stay Red_Fox, got %v", p)
+	}
+}
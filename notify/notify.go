@@ -0,0 +1,201 @@
+// Package notify sends camera alerts and captures to messaging services.
+package notify
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/plord12/trailcameradownload/detection"
+)
+
+// Severity of a message
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	}
+	return "info"
+}
+
+// Message is a single alert, with optional attached files
+//
+// Capture and Status carry the details behind the text for notifiers that
+// publish structured data
+type Message struct {
+	Text        string
+	Attachments []string
+	Severity    Severity
+	Capture     *Capture
+	Status      *Status
+}
+
+// Capture is a camera file and the objects found in it, Battery is -1 if not
+// known
+type Capture struct {
+	Run         string
+	Camera      string
+	File        string
+	Time        string
+	Battery     int
+	Description string
+	Labels      []detection.Label
+	// highest scoring detection of each label
+	Detections []detection.Detection
+}
+
+// Status is the state of a camera at the start of a run, Battery is -1 if not
+// known
+type Status struct {
+	Run     string
+	Camera  string
+	Battery int
+	Files   int
+}
+
+// Notifier sends messages
+type Notifier interface {
+	Notify(message Message) error
+}
+
+// Errors is returned by Multi when some notifiers fail
+type Errors []error
+
+func (e Errors) Error() string {
+	var s []string
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, ", ")
+}
+
+// Multi sends each message to every notifier at the same time, failing if any
+// of them fail
+type Multi []Notifier
+
+// Notify sends message to every notifier
+func (m Multi) Notify(message Message) error {
+	errs := make([]error, len(m))
+
+	var wg sync.WaitGroup
+	for i, notifier := range m {
+		wg.Add(1)
+		go func(i int, notifier Notifier) {
+			defer wg.Done()
+			errs[i] = notifier.Notify(message)
+		}(i, notifier)
+	}
+	wg.Wait()
+
+	var failed Errors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// BestEffort sends to Notifier, logging rather than returning any failure so
+// that, within Multi, it doesn't stop files being deleted
+type BestEffort struct {
+	Notifier Notifier
+}
+
+// Notify sends message, always succeeding
+func (b BestEffort) Notify(message Message) error {
+	if err := b.Notifier.Notify(message); err != nil {
+		log.Println(err.Error())
+	}
+	return nil
+}
+
+// Captures returns the notifiers within notifier that publish capture details
+// rather than just text and attachments, MQTT and Webhook, or nil if there are
+// none
+func Captures(notifier Notifier) Notifier {
+	switch n := notifier.(type) {
+	case Multi:
+		var captures Multi
+		for _, notifier := range n {
+			if c := Captures(notifier); c != nil {
+				captures = append(captures, c)
+			}
+		}
+		if len(captures) == 0 {
+			return nil
+		}
+		return captures
+	case BestEffort:
+		if c := Captures(n.Notifier); c != nil {
+			return BestEffort{Notifier: c}
+		}
+	case Digest:
+		return Captures(n.Notifier)
+	case *MQTT, *Webhook:
+		return notifier
+	}
+	return nil
+}
+
+// Digest marks a notifier that gets a digest of the captures in a run rather
+// than a message for each, other messages are sent straight away
+type Digest struct {
+	Notifier Notifier
+}
+
+// Notify sends message
+func (d Digest) Notify(message Message) error {
+	return d.Notifier.Notify(message)
+}
+
+// SplitDigest splits notifier into those to send each capture to and those
+// wanting a digest, either nil if there are none
+func SplitDigest(notifier Notifier) (Notifier, Notifier) {
+	switch n := notifier.(type) {
+	case Multi:
+		var now, digest Multi
+		for _, notifier := range n {
+			nowPart, digestPart := SplitDigest(notifier)
+			if nowPart != nil {
+				now = append(now, nowPart)
+			}
+			if digestPart != nil {
+				digest = append(digest, digestPart)
+			}
+		}
+		var nowNotifier, digestNotifier Notifier
+		if len(now) > 0 {
+			nowNotifier = now
+		}
+		if len(digest) > 0 {
+			digestNotifier = digest
+		}
+		return nowNotifier, digestNotifier
+	case BestEffort:
+		now, digest := SplitDigest(n.Notifier)
+		if now != nil {
+			now = BestEffort{Notifier: now}
+		}
+		if digest != nil {
+			digest = BestEffort{Notifier: digest}
+		}
+		return now, digest
+	case Digest:
+		return nil, n.Notifier
+	}
+	return notifier, nil
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type recorder struct {
+	messages []Message
+	err      error
+}
+
+func (r *recorder) Notify(message Message) error {
+	r.messages = append(r.messages, message)
+	return r.err
+}
+
+func TestMulti(t *testing.T) {
+	a := &recorder{}
+	b := &recorder{}
+	message := Message{Text: "hello", Attachments: []string{"a.jpg"}}
+
+	err := Multi{a, b}.Notify(message)
+	if err != nil {
+		t.Errorf("unexpected error - %v", err)
+	}
+	if len(a.messages) != 1 || len(b.messages) != 1 {
+		t.Errorf("message not sent to all notifiers")
+	}
+
+	b.err = errors.New("failed")
+	err = Multi{a, b}.Notify(message)
+	if err == nil || len(a.messages) != 2 {
+		t.Errorf("expected error and message to still be sent - %v", err)
+	}
+
+	if err = (Multi{}).Notify(message); err != nil {
+		t.Errorf("unexpected error from no notifiers - %v", err)
+	}
+
+	// best effort failures don't fail the others
+	//
+	err = Multi{a, BestEffort{b}}.Notify(message)
+	if err != nil || len(a.messages) != 3 || len(b.messages) != 3 {
+		t.Errorf("expected best effort to be sent without error - %v", err)
+	}
+}
+
+func TestCaptures(t *testing.T) {
+	mqtt := &MQTT{}
+	webhook := &Webhook{}
+	captures := Captures(Multi{&Signal{}, BestEffort{mqtt}, Multi{&Email{}, webhook}})
+	expected := Multi{BestEffort{mqtt}, Multi{webhook}}
+	if !reflect.DeepEqual(captures, expected) {
+		t.Errorf("unexpected capture notifiers %v", captures)
+	}
+	if captures = Captures(Multi{&Signal{}, &Email{}}); captures != nil {
+		t.Errorf("expected no capture notifiers, got %v", captures)
+	}
+}
+
+func TestSplitDigest(t *testing.T) {
+	signal := &Signal{}
+	email := &Email{}
+	mqtt := &MQTT{}
+
+	now, digest := SplitDigest(Multi{signal, Digest{email}, BestEffort{mqtt}})
+	if !reflect.DeepEqual(now, Multi{signal, BestEffort{mqtt}}) || !reflect.DeepEqual(digest, Multi{email}) {
+		t.Errorf("unexpected split %v %v", now, digest)
+	}
+	if now, digest = SplitDigest(Digest{Multi{signal, mqtt}}); now != nil || !reflect.DeepEqual(digest, Multi{signal, mqtt}) {
+		t.Errorf("expected all in the digest, got %v %v", now, digest)
+	}
+	if now, digest = SplitDigest(signal); now != signal || digest != nil {
+		t.Errorf("expected no digest, got %v %v", now, digest)
+	}
+}
+
+func TestSignalArgs(t *testing.T) {
+	s := &Signal{User: "+440", Recipients: []string{"+441", "+442"}}
+	args := s.args(Message{Text: "hello", Attachments: []string{"a.jpg", "b.jpg"}})
+	expected := []string{"-u", "+440", "send", "+441", "+442", "-m", "hello", "-a", "a.jpg", "b.jpg"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	s.Group = "group"
+	args = s.args(Message{Text: "hello"})
+	expected = []string{"-u", "+440", "send", "-g", "group", "-m", "hello"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args %v", args)
+	}
+}
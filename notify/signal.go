@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+)
+
+// Signal sends messages with signal-cli, to a group if set otherwise to the
+// recipients
+type Signal struct {
+	User       string
+	Group      string
+	Recipients []string
+}
+
+// signal-cli arguments for a message
+func (s *Signal) args(message Message) []string {
+	var args []string
+	args = append(args, "-u")
+	args = append(args, s.User)
+	args = append(args, "send")
+	if len(s.Group) > 0 {
+		args = append(args, "-g")
+		args = append(args, s.Group)
+	} else {
+		args = append(args, s.Recipients...)
+	}
+	if len(message.Text) > 0 {
+		args = append(args, "-m")
+		args = append(args, message.Text)
+	}
+	if len(message.Attachments) > 0 {
+		args = append(args, "-a")
+		args = append(args, message.Attachments...)
+	}
+	return args
+}
+
+// Notify sends message via signal-cli
+func (s *Signal) Notify(message Message) error {
+
+	// keep signal happy
+	//
+	// better to do this from cron
+	//
+	//cmd := exec.Command("signal-cli", "-u", s.User, "receive")
+
+	args := s.args(message)
+	log.Printf("signal-cli %v\n", args)
+	cmd := exec.Command("signal-cli", args...)
+
+	stdout, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.New("signal-cli failed - " + string(stdout))
+	}
+
+	return nil
+}
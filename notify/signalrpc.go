@@ -0,0 +1,295 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignalRPC sends messages through a running signal-cli daemon using JSON-RPC,
+// avoiding starting signal-cli for every message
+//
+// URL is either the daemon HTTP endpoint (signal-cli daemon --http), for
+// example http://localhost:8080/api/v1/rpc, or its socket as
+// unix:///run/signal-cli/socket or tcp://localhost:7583
+//
+// a message is only sent once every recipient has it, with Partial once any
+// recipient has it
+type SignalRPC struct {
+	URL        string
+	Account    string
+	Group      string
+	Recipients []string
+	Partial    bool
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	id     int
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// RecipientResult is the delivery result for one recipient
+type RecipientResult struct {
+	Number string
+	UUID   string
+	Type   string
+}
+
+// Delivered reports whether the message reached the recipient
+func (r RecipientResult) Delivered() bool {
+	return r.Type == "SUCCESS"
+}
+
+// SendResult is the reply from the daemon to a send
+type SendResult struct {
+	Timestamp int64
+	Results   []RecipientResult
+}
+
+// DeliveryError is returned when the daemon could not deliver to the
+// recipients
+type DeliveryError struct {
+	Result SendResult
+}
+
+func (e *DeliveryError) Error() string {
+	var failed []string
+	for _, r := range e.Result.Results {
+		if !r.Delivered() {
+			address := r.Number
+			if len(address) == 0 {
+				address = r.UUID
+			}
+			failed = append(failed, address+" "+r.Type)
+		}
+	}
+	return "signal delivery failed - " + strings.Join(failed, ", ")
+}
+
+// RPCError is an error reply from the daemon
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("signal-cli error %d - %s", e.Code, e.Message)
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      int         `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+	ID      *int            `json:"id"`
+}
+
+type sendParams struct {
+	Account     string   `json:"account,omitempty"`
+	Recipient   []string `json:"recipient,omitempty"`
+	GroupID     string   `json:"groupId,omitempty"`
+	Message     string   `json:"message"`
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+type sendResult struct {
+	Timestamp int64 `json:"timestamp"`
+	Results   []struct {
+		RecipientAddress struct {
+			UUID   string `json:"uuid"`
+			Number string `json:"number"`
+		} `json:"recipientAddress"`
+		Type string `json:"type"`
+	} `json:"results"`
+}
+
+// Send sends message, returning the delivery result for each recipient
+func (s *SignalRPC) Send(message Message) (*SendResult, error) {
+
+	params := sendParams{
+		Account:     s.Account,
+		Message:     message.Text,
+		Attachments: message.Attachments,
+	}
+	if len(s.Group) > 0 {
+		params.GroupID = s.Group
+	} else {
+		params.Recipient = s.Recipients
+	}
+
+	raw, err := s.call("send", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply sendResult
+	err = json.Unmarshal(raw, &reply)
+	if err != nil {
+		return nil, errors.New("unable to parse signal-cli reply - " + err.Error())
+	}
+
+	result := &SendResult{Timestamp: reply.Timestamp}
+	for _, r := range reply.Results {
+		result.Results = append(result.Results, RecipientResult{
+			Number: r.RecipientAddress.Number,
+			UUID:   r.RecipientAddress.UUID,
+			Type:   r.Type,
+		})
+	}
+	return result, nil
+}
+
+// Notify sends message, failing if any recipient doesn't have it or with
+// Partial if none have it
+func (s *SignalRPC) Notify(message Message) error {
+
+	log.Printf("signal-cli rpc send %q %v\n", message.Text, message.Attachments)
+
+	result, err := s.Send(message)
+	if err != nil {
+		return err
+	}
+	delivered, failed := 0, 0
+	for _, r := range result.Results {
+		if r.Delivered() {
+			delivered++
+		} else {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	deliveryErr := &DeliveryError{Result: *result}
+	if delivered == 0 || !s.Partial {
+		return deliveryErr
+	}
+	log.Println(deliveryErr.Error())
+	return nil
+}
+
+// Close closes any socket to the daemon
+func (s *SignalRPC) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// make a JSON-RPC call, returning the result
+func (s *SignalRPC) call(method string, params interface{}) (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.id++
+	request := rpcRequest{JSONRPC: "2.0", Method: method, Params: params, ID: s.id}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response *rpcResponse
+	if strings.HasPrefix(s.URL, "unix://") || strings.HasPrefix(s.URL, "tcp://") {
+		response, err = s.callSocket(body, request.ID)
+	} else {
+		response, err = s.callHTTP(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	return response.Result, nil
+}
+
+func (s *SignalRPC) callHTTP(body []byte) (*rpcResponse, error) {
+
+	client := s.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.New("unable to reach signal-cli daemon - " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("signal-cli daemon replied " + resp.Status)
+	}
+
+	var response rpcResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, errors.New("unable to parse signal-cli reply - " + err.Error())
+	}
+	return &response, nil
+}
+
+// socket messages are one per line, other lines such as received message
+// notifications are skipped
+func (s *SignalRPC) callSocket(body []byte, id int) (*rpcResponse, error) {
+
+	if s.conn == nil {
+		network, address := "unix", strings.TrimPrefix(s.URL, "unix://")
+		if strings.HasPrefix(s.URL, "tcp://") {
+			network, address = "tcp", strings.TrimPrefix(s.URL, "tcp://")
+		}
+		conn, err := net.DialTimeout(network, address, 10*time.Second)
+		if err != nil {
+			return nil, errors.New("unable to reach signal-cli daemon - " + err.Error())
+		}
+		s.conn = conn
+		s.reader = bufio.NewReader(conn)
+	}
+
+	// drop the connection on any failure, so the next call reconnects
+	//
+	fail := func(err error) (*rpcResponse, error) {
+		s.conn.Close()
+		s.conn = nil
+		return nil, errors.New("signal-cli daemon connection failed - " + err.Error())
+	}
+
+	s.conn.SetDeadline(time.Now().Add(time.Minute))
+	_, err := s.conn.Write(append(body, '\n'))
+	if err != nil {
+		return fail(err)
+	}
+
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF && len(line) == 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return fail(err)
+		}
+		var response rpcResponse
+		if json.Unmarshal(line, &response) != nil || response.ID == nil || *response.ID != id {
+			continue
+		}
+		return &response, nil
+	}
+}
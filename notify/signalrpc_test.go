@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stand-in signal-cli daemon, replying with type for each recipient
+type fakeDaemon struct {
+	types    map[string]string
+	requests []rpcRequest
+	params   []sendParams
+}
+
+func (d *fakeDaemon) reply(line []byte) interface{} {
+	var request struct {
+		rpcRequest
+		Params sendParams `json:"params"`
+	}
+	json.Unmarshal(line, &request)
+	d.requests = append(d.requests, request.rpcRequest)
+	d.params = append(d.params, request.Params)
+
+	if request.Method != "send" {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": request.ID,
+			"error": map[string]interface{}{"code": -32601, "message": "Method not implemented"}}
+	}
+
+	var results []interface{}
+	for _, recipient := range request.Params.Recipient {
+		t := d.types[recipient]
+		if len(t) == 0 {
+			t = "SUCCESS"
+		}
+		results = append(results, map[string]interface{}{
+			"recipientAddress": map[string]string{"number": recipient, "uuid": "uuid-" + recipient},
+			"type":             t,
+		})
+	}
+	return map[string]interface{}{"jsonrpc": "2.0", "id": request.ID,
+		"result": map[string]interface{}{"timestamp": 1670300000000, "results": results}}
+}
+
+func TestSignalRPCHTTP(t *testing.T) {
+	daemon := &fakeDaemon{types: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/rpc" {
+			http.NotFound(w, r)
+			return
+		}
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(daemon.reply(body))
+	}))
+	defer server.Close()
+
+	s := &SignalRPC{URL: server.URL + "/api/v1/rpc", Account: "+440", Recipients: []string{"+441", "+442"}}
+	message := Message{Text: "hello", Attachments: []string{"a.jpg", "b.jpg"}}
+
+	result, err := s.Send(message)
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	expected := []RecipientResult{{Number: "+441", UUID: "uuid-+441", Type: "SUCCESS"}, {Number: "+442", UUID: "uuid-+442", Type: "SUCCESS"}}
+	if result.Timestamp != 1670300000000 || !reflect.DeepEqual(result.Results, expected) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	params := sendParams{Account: "+440", Recipient: []string{"+441", "+442"}, Message: "hello", Attachments: []string{"a.jpg", "b.jpg"}}
+	if !reflect.DeepEqual(daemon.params[0], params) {
+		t.Errorf("unexpected params %+v", daemon.params[0])
+	}
+
+	// every recipient must have it unless partial delivery is allowed
+	//
+	daemon.types["+442"] = "UNREGISTERED_FAILURE"
+	err = s.Notify(message)
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) || deliveryErr.Result.Results[1].Delivered() || !deliveryErr.Result.Results[0].Delivered() {
+		t.Errorf("expected delivery error, got %v", err)
+	}
+	s.Partial = true
+	if err = s.Notify(message); err != nil {
+		t.Errorf("unexpected error with one recipient delivered - %v", err)
+	}
+	daemon.types["+441"] = "NETWORK_FAILURE"
+	if err = s.Notify(message); !errors.As(err, &deliveryErr) {
+		t.Errorf("expected delivery error with no recipient delivered, got %v", err)
+	}
+
+	s.URL = server.URL + "/missing"
+	if err = s.Notify(message); err == nil {
+		t.Errorf("expected error from missing endpoint")
+	}
+}
+
+func TestSignalRPCSocket(t *testing.T) {
+	daemon := &fakeDaemon{types: map[string]string{}}
+	socket := filepath.Join(t.TempDir(), "socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					// the daemon also sends notifications for received messages
+					//
+					conn.Write([]byte(`{"jsonrpc":"2.0","method":"receive","params":{}}` + "\n"))
+					reply, _ := json.Marshal(daemon.reply(scanner.Bytes()))
+					conn.Write(append(reply, '\n'))
+				}
+			}()
+		}
+	}()
+
+	s := &SignalRPC{URL: "unix://" + socket, Group: "group"}
+	defer s.Close()
+
+	for i := 1; i <= 2; i++ {
+		if err = s.Notify(Message{Text: "hello"}); err != nil {
+			t.Fatalf("unexpected error - %v", err)
+		}
+		if daemon.requests[i-1].ID != i || daemon.params[i-1].GroupID != "group" || daemon.params[i-1].Recipient != nil {
+			t.Errorf("unexpected request %+v %+v", daemon.requests[i-1], daemon.params[i-1])
+		}
+	}
+
+	// reconnects after the connection breaks
+	//
+	s.conn.Close()
+	if err = s.Notify(Message{Text: "hello"}); err == nil {
+		t.Errorf("expected error from closed connection")
+	}
+	if err = s.Notify(Message{Text: "hello"}); err != nil {
+		t.Errorf("expected reconnect - %v", err)
+	}
+
+	_, err = s.call("version", nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("expected rpc error, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/plord12/trailcameradownload/detection"
+)
+
+// Webhook posts each message as a JSON document to URL
+//
+// attachments are included base64 encoded in the JSON, or as further parts of
+// a multipart/form-data request if Multipart is set
+//
+// with Secret set the request body is signed with HMAC-SHA256, sent as
+// X-Signature-256: sha256=<hex>
+type Webhook struct {
+	URL        string
+	Secret     string
+	Multipart  bool
+	HTTPClient *http.Client
+}
+
+// WebhookPayload is the JSON document posted for a message
+type WebhookPayload struct {
+	Type        string                `json:"type"`
+	Run         string                `json:"run,omitempty"`
+	Camera      string                `json:"camera,omitempty"`
+	Timestamp   string                `json:"timestamp,omitempty"`
+	Sent        time.Time             `json:"sent"`
+	File        string                `json:"file,omitempty"`
+	Text        string                `json:"text"`
+	Severity    string                `json:"severity"`
+	Description string                `json:"description,omitempty"`
+	Labels      []detection.Label     `json:"labels,omitempty"`
+	Detections  []detection.Detection `json:"detections,omitempty"`
+	Battery     *int                  `json:"battery,omitempty"`
+	Files       *int                  `json:"files,omitempty"`
+	Attachments []WebhookAttachment   `json:"attachments,omitempty"`
+}
+
+// WebhookAttachment is an attached file, Data is only set when not multipart
+type WebhookAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data,omitempty"`
+}
+
+// payload for a message
+func (w *Webhook) payload(message Message, sent time.Time) WebhookPayload {
+
+	payload := WebhookPayload{Type: "alert", Sent: sent, Text: message.Text, Severity: message.Severity.String()}
+
+	battery := -1
+	if message.Capture != nil {
+		payload.Type = "capture"
+		payload.Run = message.Capture.Run
+		payload.Camera = message.Capture.Camera
+		payload.Timestamp = message.Capture.Time
+		payload.File = message.Capture.File
+		payload.Description = message.Capture.Description
+		payload.Labels = message.Capture.Labels
+		payload.Detections = message.Capture.Detections
+		battery = message.Capture.Battery
+	} else if message.Status != nil {
+		payload.Type = "status"
+		payload.Run = message.Status.Run
+		payload.Camera = message.Status.Camera
+		payload.Files = &message.Status.Files
+		battery = message.Status.Battery
+	}
+	if battery >= 0 {
+		payload.Battery = &battery
+	}
+	return payload
+}
+
+// Notify posts message
+func (w *Webhook) Notify(message Message) error {
+
+	body, mediaType, err := w.body(w.payload(message, time.Now()), message.Attachments)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", mediaType)
+	if len(w.Secret) > 0 {
+		request.Header.Set("X-Signature-256", Sign(w.Secret, body))
+	}
+
+	client := w.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	log.Printf("webhook %s %q\n", w.URL, message.Text)
+	resp, err := client.Do(request)
+	if err != nil {
+		return errors.New("webhook failed - " + err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("webhook failed - " + resp.Status)
+	}
+	return nil
+}
+
+// request body and content type, with the payload and attachments
+func (w *Webhook) body(payload WebhookPayload, attachments []string) ([]byte, string, error) {
+
+	for _, fileName := range attachments {
+		attachment := WebhookAttachment{Name: filepath.Base(fileName), ContentType: contentType(fileName)}
+		if !w.Multipart {
+			data, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				return nil, "", errors.New("unable to read attachment - " + err.Error())
+			}
+			attachment.Data = data
+		}
+		payload.Attachments = append(payload.Attachments, attachment)
+	}
+
+	document, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	if !w.Multipart {
+		return document, "application/json", nil
+	}
+
+	// payload part first, then a file part for each attachment
+	//
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="payload"`},
+		"Content-Type":        {"application/json"},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	part.Write(document)
+
+	for i, fileName := range attachments {
+		part, err = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Disposition": {mime.FormatMediaType("form-data", map[string]string{"name": "attachment", "filename": payload.Attachments[i].Name})},
+			"Content-Type":        {payload.Attachments[i].ContentType},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, "", errors.New("unable to read attachment - " + err.Error())
+		}
+		_, err = io.Copy(part, file)
+		file.Close()
+		if err != nil {
+			return nil, "", errors.New("unable to read attachment - " + err.Error())
+		}
+	}
+	writer.Close()
+
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// Sign returns the signature of body with secret, as sent in X-Signature-256
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
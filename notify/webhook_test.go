@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/plord12/trailcameradownload/detection"
+)
+
+func TestWebhook(t *testing.T) {
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{header: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	image := filepath.Join(t.TempDir(), "image.JPG")
+	os.WriteFile(image, []byte("jpeg data"), 0644)
+
+	capture := &Capture{
+		Run:         "20221206-063000",
+		Camera:      "garden",
+		File:        `A:\DCIM\PHOTO\IM_00001.JPG`,
+		Time:        "2022/12/05 23:43:40",
+		Battery:     80,
+		Description: " Red Fox (85.4%)",
+		Labels:      []detection.Label{{Name: "Red_Fox", Score: 0.854}},
+		Detections:  []detection.Detection{{Label: "Red_Fox", Score: 0.9, Box: detection.Box{Left: 0.1, Top: 0.2, Right: 0.3, Bottom: 0.4}}},
+	}
+	w := &Webhook{URL: server.URL, Secret: "secret"}
+
+	err := w.Notify(Message{Text: "capture", Attachments: []string{image}, Capture: capture})
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	r := <-requests
+	if r.header.Get("Content-Type") != "application/json" || r.header.Get("X-Signature-256") != Sign("secret", r.body) {
+		t.Errorf("unexpected headers %v", r.header)
+	}
+	var payload WebhookPayload
+	if err = json.Unmarshal(r.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Type != "capture" || payload.Run != capture.Run || payload.File != capture.File || payload.Timestamp != capture.Time ||
+		payload.Battery == nil || *payload.Battery != 80 || !reflect.DeepEqual(payload.Detections, capture.Detections) {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if len(payload.Attachments) != 1 || string(payload.Attachments[0].Data) != "jpeg data" || payload.Attachments[0].ContentType != "image/jpeg" {
+		t.Errorf("unexpected attachments %+v", payload.Attachments)
+	}
+
+	// multipart, without a secret
+	//
+	w = &Webhook{URL: server.URL, Multipart: true}
+	if err = w.Notify(Message{Text: "capture", Attachments: []string{image}, Capture: capture}); err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+	r = <-requests
+	if r.header.Get("X-Signature-256") != "" {
+		t.Errorf("unexpected signature")
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		t.Fatalf("unexpected content type %s", mediaType)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(r.body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload = WebhookPayload{}
+	if len(form.Value["payload"]) != 1 || json.Unmarshal([]byte(form.Value["payload"][0]), &payload) != nil ||
+		len(payload.Attachments) != 1 || payload.Attachments[0].Data != nil {
+		t.Errorf("unexpected payload part %v", form.Value)
+	}
+	if len(form.File["attachment"]) != 1 || form.File["attachment"][0].Filename != "image.JPG" {
+		t.Errorf("unexpected attachment parts %v", form.File)
+	}
+
+	// status and failures
+	//
+	status = http.StatusInternalServerError
+	err = w.Notify(Message{Text: "battery", Status: &Status{Run: "1", Camera: "garden", Battery: -1, Files: 3}})
+	if err == nil {
+		t.Errorf("expected error for failed webhook")
+	}
+	r = <-requests
+	_, params, _ = mime.ParseMediaType(r.header.Get("Content-Type"))
+	form, _ = multipart.NewReader(bytes.NewReader(r.body), params["boundary"]).ReadForm(1 << 20)
+	payload = WebhookPayload{}
+	json.Unmarshal([]byte(form.Value["payload"][0]), &payload)
+	if payload.Type != "status" || payload.Battery != nil || payload.Files == nil || *payload.Files != 3 {
+		t.Errorf("unexpected status payload %+v", payload)
+	}
+}
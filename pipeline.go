@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/plord12/trailcameradownload/camera"
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/notify"
+)
+
+// Picture is a single camera file moving through the pipeline
+type Picture struct {
+	fileName    string
+	tmpFilename string
+	timeStamp   string
+	file        camera.File
+	camera      string
+	run         string
+	battery     int
+
+	result *detection.Result
+}
+
+// concurrency of each pipeline stage
+//
+// each stage queues at most queue pictures for the next, so a slow stage holds
+// back the ones before it
+type pipelineConfig struct {
+	downloaders int
+	detectors   int
+	notifiers   int
+	queue       int
+}
+
+// how pictures are fetched, reported and removed from the camera
+//
+// with a router, rules pick the notifier for each picture or archive or drop
+// it instead, archived files are saved in archive.  With a digest, pictures
+// are reported together to notifiers wanting one once all are processed.  With stillOnly, videos are
+// reported with just their best frame
+type pipelineStages struct {
+	fetch     func(picture *Picture) error
+	notify    notify.Notifier
+	router    *router
+	archive   string
+	digest    *digest
+	stillOnly bool
+	remove    func(picture *Picture) error
+}
+
+// download, detect and notify pictures, deleting each only once notified
+//
+// once ctx is done no more files are downloaded, those already downloaded are
+// still processed
+func runPipeline(ctx context.Context, pictures []Picture, config pipelineConfig, stages pipelineStages, limits *int) {
+
+	maxFiles := len(pictures)
+
+	if config.downloaders < 1 {
+		config.downloaders = 1
+	}
+	if config.detectors < 1 {
+		config.detectors = 1
+	}
+	if config.notifiers < 1 {
+		config.notifiers = 1
+	}
+
+	queued := make(chan Picture, config.queue)
+	downloaded := make(chan Picture, config.queue)
+	detected := make(chan Picture, config.queue)
+
+	go func() {
+		defer close(queued)
+		for _, picture := range pictures {
+			select {
+			case <-ctx.Done():
+				return
+			case queued <- picture:
+			}
+		}
+	}()
+
+	// download stage
+	//
+	var downloadWg sync.WaitGroup
+	for i := 0; i < config.downloaders; i++ {
+		downloadWg.Add(1)
+		go func() {
+			defer downloadWg.Done()
+			for picture := range queued {
+				if ctx.Err() != nil {
+					continue
+				}
+				err := stages.fetch(&picture)
+				if err != nil {
+					// leave it on the camera and carry on with the next file
+					//
+					log.Printf("Failed to download %s - %s\n", picture.fileName, err.Error())
+					continue
+				}
+				downloaded <- picture
+			}
+		}()
+	}
+	go func() {
+		downloadWg.Wait()
+		close(downloaded)
+		if ctx.Err() != nil {
+			log.Println("Stopped download, remaining files left on camera")
+		} else {
+			log.Println("Finished download")
+		}
+	}()
+
+	// detection stage
+	//
+	var detectWg sync.WaitGroup
+	for i := 0; i < config.detectors; i++ {
+		detectWg.Add(1)
+		go func() {
+			defer detectWg.Done()
+			for picture := range downloaded {
+				if modelLoaded {
+					result, err := objectDetect(&picture.tmpFilename, limits, false)
+					if err != nil {
+						log.Println(err.Error())
+					} else {
+						picture.result = result
+					}
+				}
+				detected <- picture
+			}
+		}()
+	}
+	go func() {
+		detectWg.Wait()
+		close(detected)
+	}()
+
+	// notify and delete stage
+	//
+	var fileCount int32
+	var notifyWg sync.WaitGroup
+	for i := 0; i < config.notifiers; i++ {
+		notifyWg.Add(1)
+		go func() {
+			defer notifyWg.Done()
+			for picture := range detected {
+				count := atomic.AddInt32(&fileCount, 1)
+
+				title := picture.timeStamp
+				if len(picture.camera) > 0 {
+					title = picture.camera + " " + picture.timeStamp
+				}
+
+				message := notify.Message{
+					Capture: &notify.Capture{
+						Run:     picture.run,
+						Camera:  picture.camera,
+						File:    picture.fileName,
+						Time:    picture.timeStamp,
+						Battery: picture.battery,
+					},
+				}
+				if picture.result != nil {
+					message.Capture.Description = picture.result.Description
+					message.Capture.Labels = picture.result.Labels
+					message.Capture.Detections = picture.result.Best()
+				}
+				if len(message.Capture.Description) > 0 {
+					message.Text = fmt.Sprintf("[%d of %d] %s description: %s", count, maxFiles, title, message.Capture.Description)
+					original := picture.tmpFilename
+					if len(picture.result.Trimmed) > 0 {
+						original = picture.result.Trimmed
+					}
+					message.Attachments = []string{original, picture.result.Output}
+				} else {
+					message.Text = fmt.Sprintf("[%d of %d] %s", count, maxFiles, title)
+					message.Attachments = []string{picture.tmpFilename}
+				}
+
+				// without detection rules have nothing to go on, so the file is
+				// sent as it is rather than risk archiving or dropping it unseen
+				//
+				var err error
+				to := route{rule: -1, action: actionNotify, notifier: stages.notify}
+				if picture.result != nil {
+					to = stages.router.route(message.Capture.Labels, stages.notify)
+				}
+				switch to.action {
+				case actionArchive:
+					log.Printf("Archiving %s\n", picture.fileName)
+					err = archive(stages.archive, message.Attachments, picture.timeStamp)
+				case actionDrop:
+					log.Printf("Dropping %s\n", picture.fileName)
+				default:
+					message.Severity = to.severity
+
+					message.Attachments = picture.alertFiles(message.Attachments, stages.stillOnly)
+
+					// urgent captures aren't held back for the digest.  Only the
+					// text and attachments wait for it, notifiers recording
+					// each capture such as MQTT still get its details now
+					//
+					now, later := to.notifier, notify.Notifier(nil)
+					if stages.digest != nil && to.severity < notify.Critical {
+						now, later = notify.SplitDigest(to.notifier)
+					}
+					if later != nil {
+						if captures := notify.Captures(later); captures != nil {
+							if err := captures.Notify(notify.Message{Capture: message.Capture, Severity: to.severity}); err != nil {
+								log.Println(err.Error())
+							}
+						}
+					}
+					if now != nil {
+						err = now.Notify(message)
+					}
+
+					// once sent to the others, the digest deletes it from the
+					// camera
+					//
+					if later != nil && err == nil {
+						to.notifier = later
+						stages.digest.add(to, picture)
+						continue
+					}
+				}
+
+				picture.cleanup()
+
+				if err != nil {
+					log.Println(err.Error())
+					continue
+				}
+
+				// all good, can now delete on camera
+				//
+				removeFromCamera(&picture, stages.remove)
+			}
+		}()
+	}
+	notifyWg.Wait()
+
+	stages.digest.send(stages.remove)
+}
+
+// files to send for a capture rather than files, the best frame of a video
+// first then its preview, which is much smaller than the videos
+func (p *Picture) alertFiles(files []string, stillOnly bool) []string {
+	if p.result == nil {
+		return files
+	}
+	var attachments []string
+	if len(p.result.Still) > 0 {
+		attachments = append(attachments, p.result.Still)
+		if stillOnly {
+			return attachments
+		}
+	}
+	if len(p.result.Preview) > 0 {
+		return append(attachments, p.result.Preview)
+	}
+	return append(attachments, files...)
+}
+
+// remove temporary files
+func (p *Picture) cleanup() {
+	if p.tmpFilename != p.fileName {
+		os.Remove(p.tmpFilename)
+	}
+	if p.result != nil {
+		os.Remove(p.result.Output)
+		for _, fileName := range []string{p.result.Preview, p.result.Still, p.result.Trimmed} {
+			if len(fileName) > 0 {
+				os.Remove(fileName)
+			}
+		}
+	}
+}
+
+func removeFromCamera(picture *Picture, remove func(picture *Picture) error) {
+	err := remove(picture)
+	if err != nil {
+		log.Println("Failed to delete " + picture.fileName + " - " + err.Error())
+	}
+}
+
+// pipeline stages for files downloaded from the camera over WiFi
+func cameraStages(client *camera.Client, savejpg bool, undeleted *undeletedList, notifier notify.Notifier) pipelineStages {
+	return pipelineStages{
+		fetch: func(picture *Picture) error {
+			tmpFile, err := download(picture.file, client)
+			if err != nil {
+				os.Remove(tmpFile)
+				return err
+			}
+			picture.tmpFilename = tmpFile
+			if savejpg {
+				saveCopy(picture.fileName, picture.tmpFilename, picture.timeStamp)
+			}
+			return nil
+		},
+		notify: notifier,
+		remove: func(picture *Picture) error {
+			err := deleteFile(picture.fileName, client)
+			if camera.IsNoFile(err) {
+				log.Printf("%s already deleted\n", picture.fileName)
+				return nil
+			}
+			if err != nil {
+				undeleted.add(picture.fileName)
+			}
+			return err
+		},
+	}
+}
+
+// pipeline stages for files on the locally mounted camera
+func localStages(savejpg bool, notifier notify.Notifier) pipelineStages {
+	return pipelineStages{
+		fetch: func(picture *Picture) error {
+			if savejpg {
+				saveCopy(picture.fileName, picture.tmpFilename, picture.timeStamp)
+			}
+			return nil
+		},
+		notify: notifier,
+		remove: func(picture *Picture) error {
+			return os.Remove(picture.fileName)
+		},
+	}
+}
+
+// save a copy of a jpg file in $HOME/photos
+func saveCopy(fileName string, tmpFilename string, timeStamp string) {
+
+	if !strings.EqualFold(filepath.Ext(fileName), ".JPG") && !strings.EqualFold(filepath.Ext(fileName), ".JPEG") {
+		return
+	}
+
+	err := copyFile(os.Getenv("HOME")+"/photos/", tmpFilename, timeStamp, ".jpg")
+	if err != nil {
+		log.Printf("Unable to copy %s - %s\n", fileName, err.Error())
+	}
+}
+
+// save copies of files in dir, $HOME/photos if empty
+func archive(dir string, fileNames []string, timeStamp string) error {
+
+	if len(dir) == 0 {
+		dir = os.Getenv("HOME") + "/photos/"
+	}
+	for _, fileName := range fileNames {
+		err := copyFile(dir, fileName, timeStamp, strings.ToLower(filepath.Ext(fileName)))
+		if err != nil {
+			return errors.New("unable to archive " + fileName + " - " + err.Error())
+		}
+	}
+	return nil
+}
+
+// copy a file into dir, named from its timestamp
+func copyFile(dir string, fileName string, timeStamp string, ext string) error {
+
+	source, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := ioutil.TempFile(dir, strings.Replace(strings.Replace(timeStamp+".*"+ext, "/", "_", -1), " ", "_", -1))
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+	_, err = io.Copy(destination, source)
+	return err
+}
+
+// undeletedList records files that could not be deleted from the camera
+type undeletedList struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// open the undeleted file for appending, nil if not wanted or unavailable
+func openUndeletedList(undeletedPath string) *undeletedList {
+
+	if len(undeletedPath) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(undeletedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Unable to open undeleted file - %s\n", err.Error())
+		return nil
+	}
+	return &undeletedList{file: file}
+}
+
+func (u *undeletedList) add(fileName string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, err := u.file.WriteString(fileName + "\n"); err != nil {
+		log.Println("Unable to write to undeleted file - ", err.Error())
+	}
+	u.file.Sync()
+}
+
+func (u *undeletedList) close() {
+	if u != nil {
+		u.file.Close()
+	}
+}
@@ -0,0 +1,146 @@
+// Package preview builds short, small animations from the frames of a video
+// with detections, to suit messenger attachment limits.
+package preview
+
+import (
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// preview formats
+const (
+	GIF = "gif"
+	MP4 = "mp4"
+)
+
+// Options for a preview, no preview is made without a format
+type Options struct {
+	Format   string
+	Width    int
+	FPS      float64
+	Duration time.Duration
+	MaxBytes int64
+}
+
+// DefaultFPS is the frame rate when none is given
+const DefaultFPS = 8
+
+// Encoder writes frames to fileName at fps frames per second
+type Encoder func(fileName string, frames []image.Image, fps float64) error
+
+// Builder collects frames for a preview from a video at sourceFPS
+type Builder struct {
+	options Options
+	step    float64
+	next    float64
+	frames  []image.Image
+}
+
+// NewBuilder starts a preview of a video at sourceFPS
+func NewBuilder(options Options, sourceFPS float64) *Builder {
+	if options.FPS <= 0 {
+		options.FPS = DefaultFPS
+	}
+	if sourceFPS < options.FPS {
+		sourceFPS = options.FPS
+	}
+	return &Builder{options: options, step: sourceFPS / options.FPS}
+}
+
+// Wants reports whether source frame number frame would be kept, so frames
+// needn't be converted to images for nothing
+func (b *Builder) Wants(frame int) bool {
+	if b.options.Duration > 0 && float64(len(b.frames)) >= b.options.Duration.Seconds()*b.options.FPS {
+		return false
+	}
+	return float64(frame) >= b.next
+}
+
+// Add source frame number frame to the preview, if wanted, scaled down to the
+// preview width
+func (b *Builder) Add(frame int, img image.Image) {
+	if !b.Wants(frame) {
+		return
+	}
+	b.next = float64(frame) + b.step
+
+	bounds := img.Bounds()
+	if b.options.Width > 0 && bounds.Dx() > b.options.Width {
+		scaled := image.NewRGBA(image.Rect(0, 0, b.options.Width, bounds.Dy()*b.options.Width/bounds.Dx()))
+		draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+		img = scaled
+	}
+	b.frames = append(b.frames, img)
+}
+
+// Len is the number of frames in the preview
+func (b *Builder) Len() int {
+	return len(b.frames)
+}
+
+// Write the preview to fileName with encode
+//
+// while the file is larger than MaxBytes every other frame is dropped, at
+// half the frame rate so the preview lasts as long
+func (b *Builder) Write(fileName string, encode Encoder) error {
+
+	if len(b.frames) == 0 {
+		return errors.New("no frames for preview")
+	}
+	frames, fps := b.frames, b.options.FPS
+	for {
+		err := encode(fileName, frames, fps)
+		if err != nil {
+			return errors.New("unable to write preview - " + err.Error())
+		}
+		if b.options.MaxBytes <= 0 {
+			return nil
+		}
+		fileInfo, err := os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+		if fileInfo.Size() <= b.options.MaxBytes {
+			return nil
+		}
+		if len(frames) < 2 {
+			return errors.New("preview is " + strconv.FormatInt(fileInfo.Size(), 10) + " bytes, over the limit of " + strconv.FormatInt(b.options.MaxBytes, 10))
+		}
+		half := make([]image.Image, 0, (len(frames)+1)/2)
+		for i := 0; i < len(frames); i += 2 {
+			half = append(half, frames[i])
+		}
+		frames, fps = half, fps/2
+	}
+}
+
+// EncodeGIF writes frames as a looping animated GIF
+func EncodeGIF(fileName string, frames []image.Image, fps float64) error {
+
+	delay := int(100/fps + 0.5)
+	animation := &gif.GIF{}
+	for _, frame := range frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, frame.Bounds().Min)
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, delay)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	err = gif.EncodeAll(file, animation)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
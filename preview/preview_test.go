@@ -0,0 +1,99 @@
+package preview
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func frame(width, height int, shade uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{shade, uint8(x), uint8(y), 0xff})
+		}
+	}
+	return img
+}
+
+func TestBuilder(t *testing.T) {
+
+	// 30fps source sampled at 10fps for at most 1s
+	//
+	b := NewBuilder(Options{Format: GIF, Width: 32, FPS: 10, Duration: time.Second}, 30)
+	for i := 0; i < 90; i++ {
+		if i >= 20 && i < 30 {
+			// no detections
+			continue
+		}
+		b.Add(i, frame(64, 48, uint8(i)))
+	}
+	if b.Len() != 10 {
+		t.Errorf("expected 10 frames, got %d", b.Len())
+	}
+	if bounds := b.frames[0].Bounds(); bounds.Dx() != 32 || bounds.Dy() != 24 {
+		t.Errorf("frames not scaled - %v", bounds)
+	}
+	if b.Wants(89) {
+		t.Errorf("wanted frame past the duration")
+	}
+
+	fileName := filepath.Join(t.TempDir(), "preview.gif")
+	if err := b.Write(fileName, EncodeGIF); err != nil {
+		t.Fatalf("failed to write - %v", err)
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatalf("failed to decode - %v", err)
+	}
+	if len(animation.Image) != 10 || animation.Delay[0] != 10 {
+		t.Errorf("unexpected animation of %d frames with delay %d", len(animation.Image), animation.Delay[0])
+	}
+}
+
+func TestWriteLimit(t *testing.T) {
+
+	b := NewBuilder(Options{Format: MP4, FPS: 8, MaxBytes: 100}, 8)
+	for i := 0; i < 8; i++ {
+		b.Add(i, frame(4, 4, uint8(i)))
+	}
+
+	// each frame takes 40 bytes
+	//
+	var sizes []int
+	var rates []float64
+	encode := func(fileName string, frames []image.Image, fps float64) error {
+		sizes = append(sizes, len(frames))
+		rates = append(rates, fps)
+		return os.WriteFile(fileName, make([]byte, 40*len(frames)), 0644)
+	}
+	fileName := filepath.Join(t.TempDir(), "preview.mp4")
+	if err := b.Write(fileName, encode); err != nil {
+		t.Fatalf("failed to write - %v", err)
+	}
+	if len(sizes) != 3 || sizes[2] != 2 || rates[2] != 2 {
+		t.Errorf("unexpected attempts %v at %v", sizes, rates)
+	}
+
+	b.options.MaxBytes = 10
+	if err := b.Write(fileName, encode); err == nil {
+		t.Errorf("expected error over the limit")
+	}
+
+	if err := b.Write(fileName, func(string, []image.Image, float64) error { return errors.New("no codec") }); err == nil {
+		t.Errorf("expected encoder error")
+	}
+	if err := NewBuilder(Options{}, 30).Write(fileName, encode); err == nil {
+		t.Errorf("expected error without frames")
+	}
+}
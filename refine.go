@@ -0,0 +1,53 @@
+package main
+
+import (
+	"hash/fnv"
+	"image/color"
+
+	"golang.org/x/image/colornames"
+)
+
+// score a box labelled label needs to count, from the config file, then the
+// label file, then the default
+func (d detectOptions) scoreThreshold(label string) float64 {
+	if _, ok := d.thresholds.Labels[label]; !ok {
+		if threshold, ok := labelThresholds[label]; ok {
+			return threshold
+		}
+	}
+	return d.thresholds.For(label)
+}
+
+// label and score of a box the detector gave label and score, replaced by the
+// classifier's when it's confident enough and scores the threshold for its
+// label
+func (d detectOptions) refine(label string, score float64, classified string, classifiedScore float64) (string, float64) {
+	if len(classified) == 0 || classifiedScore < d.classifierScore || classifiedScore < d.scoreThreshold(classified) {
+		return label, score
+	}
+	return classified, classifiedScore
+}
+
+// labels that detections can have, from the detector then the classifier
+func knownLabels() []string {
+	known := append([]string(nil), labels...)
+	return append(known, classifierLabels...)
+}
+
+// colour boxes labelled label are drawn in, by its place in the detector labels
+// or for classifier labels from its name
+func labelColour(label string) color.RGBA {
+	index := -1
+	for i, name := range labels {
+		if name == label {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		h := fnv.New32a()
+		h.Write([]byte(label))
+		index = int(h.Sum32() % uint32(len(colornames.Names)))
+	}
+	return colornames.Map[colornames.Names[index%len(colornames.Names)]]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/plord12/trailcameradownload/detection"
+)
+
+func TestRefine(t *testing.T) {
+
+	saved := labelThresholds
+	defer func() { labelThresholds = saved }()
+	labelThresholds = map[string]float64{"Marsh_Tit": 0.9, "Coal_Tit": 0.5}
+
+	d := detectOptions{classifierScore: 0.7, thresholds: detection.Thresholds{Default: 0.6, Labels: map[string]float64{"Coal_Tit": 0.95}}}
+	tests := []struct {
+		classified      string
+		classifiedScore float64
+		label           string
+		score           float64
+	}{
+		// confident classifier replaces the detector label
+		{"Blue_Tit", 0.9, "Blue_Tit", 0.9},
+		{"Blue_Tit", 0.7, "Blue_Tit", 0.7},
+		// otherwise the detector label is kept
+		{"Blue_Tit", 0.5, "Great_Tit", 0.8},
+		{"", 0, "Great_Tit", 0.8},
+		// nor does a score under the threshold for its label
+		{"Coal_Tit", 0.9, "Great_Tit", 0.8},
+		{"Marsh_Tit", 0.85, "Great_Tit", 0.8},
+	}
+	for _, test := range tests {
+		label, score := d.refine("Great_Tit", 0.8, test.classified, test.classifiedScore)
+		if label != test.label || score != test.score {
+			t.Errorf("%s %f: expected %s %f, got %s %f", test.classified, test.classifiedScore, test.label, test.score, label, score)
+		}
+	}
+}
+
+func TestLabelColour(t *testing.T) {
+
+	saved := labels
+	defer func() { labels = saved }()
+	labels = []string{"Great_Tit", "Blue_Tit"}
+
+	if labelColour("Blue_Tit") == labelColour("Great_Tit") {
+		t.Errorf("expected detector labels to have their own colours")
+	}
+	if labelColour("Coal_Tit") != labelColour("Coal_Tit") {
+		t.Errorf("expected the same colour for a classifier label")
+	}
+}
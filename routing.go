@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/notify"
+)
+
+// rule actions
+const (
+	actionNotify  = "notify"
+	actionArchive = "archive"
+	actionDrop    = "drop"
+)
+
+// rule routes captures by what was detected in them
+//
+// a rule with labels matches when any of them is detected scoring at least
+// its entry in scores, otherwise minscore.  A rule with nothing set matches
+// when no label scores minscore, and one with neither matches everything
+//
+// minscore defaults to the camera's description cut-off, targets to its own
+// notifiers
+type rule struct {
+	Labels   []string           `json:"labels"`
+	MinScore float64            `json:"minscore"`
+	Scores   map[string]float64 `json:"scores"`
+	Nothing  bool               `json:"nothing"`
+	Targets  []string           `json:"targets"`
+	Priority string             `json:"priority"`
+	Action   string             `json:"action"`
+}
+
+// where a capture goes, rule is the index of the matching rule or -1
+type route struct {
+	rule     int
+	action   string
+	notifier notify.Notifier
+	severity notify.Severity
+}
+
+// router picks the route for each capture from the first matching rule,
+// captures matching no rule go to the camera's notifiers
+type router struct {
+	rules   []rule
+	routes  []route
+	targets []notify.Notifier
+	cutoff  float64
+}
+
+func (r *rule) minScore(label string, cutoff float64) float64 {
+	if score, ok := r.Scores[label]; ok {
+		return score
+	}
+	if r.MinScore > 0 {
+		return r.MinScore
+	}
+	return cutoff
+}
+
+func (r *rule) matches(labels []detection.Label, cutoff float64) bool {
+
+	if r.Nothing {
+		for _, label := range labels {
+			if label.Score >= r.minScore(label.Name, cutoff) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(r.Labels) == 0 {
+		return true
+	}
+	for _, label := range labels {
+		for _, name := range r.Labels {
+			if strings.EqualFold(label.Name, name) && label.Score >= r.minScore(name, cutoff) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// severity for a rule priority
+func priority(name string) (notify.Severity, error) {
+	switch strings.ToLower(name) {
+	case "", "info", "normal", "low":
+		return notify.Info, nil
+	case "warning":
+		return notify.Warning, nil
+	case "high", "critical":
+		return notify.Critical, nil
+	}
+	return notify.Info, errors.New("unknown priority " + name)
+}
+
+// build a router for a camera from rules and named targets, each target
+// being notification settings
+//
+// a target starts with the camera's accounts and servers such as signaluser
+// and smtp but none of its destinations, the "camera" target is the camera's
+// own notifiers
+func newRouter(rules []rule, targets map[string]map[string]interface{}, opts *options) (*router, error) {
+
+	r := &router{rules: rules, cutoff: opts.detect.labelCutoff()}
+	notifiers := map[string]notify.Notifier{"camera": opts.notifier}
+	for name, settings := range targets {
+		target := options{}
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		notifyFlags(fs, &target)
+
+		// flags still point at target's fields
+		//
+		target = *opts
+		target.signalGroup = ""
+		target.signalRecipient = ""
+		target.emailTo = ""
+		target.mqttBroker = ""
+		target.webhook = ""
+
+		err := setFlags(fs, settings, nil)
+		if err != nil {
+			return nil, errors.New("target " + name + " - " + err.Error())
+		}
+		notifiers[name], err = newNotifier(&target)
+		if err != nil {
+			return nil, errors.New("target " + name + " - " + err.Error())
+		}
+		r.targets = append(r.targets, notifiers[name])
+	}
+
+	for i, rule := range rules {
+		severity, err := priority(rule.Priority)
+		if err != nil {
+			return nil, err
+		}
+		to := route{rule: i, action: rule.Action, notifier: opts.notifier, severity: severity}
+		switch rule.Action {
+		case "":
+			to.action = actionNotify
+		case actionNotify, actionArchive, actionDrop:
+		default:
+			return nil, errors.New("unknown action " + rule.Action + " in rule " + strconv.Itoa(i+1))
+		}
+		if len(rule.Targets) > 0 {
+			var multi notify.Multi
+			for _, name := range rule.Targets {
+				notifier, ok := notifiers[name]
+				if !ok {
+					return nil, errors.New("unknown target " + name + " in rule " + strconv.Itoa(i+1))
+				}
+				multi = append(multi, notifier)
+			}
+			to.notifier = multi
+		}
+		r.routes = append(r.routes, to)
+	}
+
+	return r, nil
+}
+
+// route for a capture with labels, notifier if no rule matches
+func (r *router) route(labels []detection.Label, notifier notify.Notifier) route {
+	if r != nil {
+		for i := range r.rules {
+			if r.rules[i].matches(labels, r.cutoff) {
+				return r.routes[i]
+			}
+		}
+	}
+	return route{rule: -1, action: actionNotify, notifier: notifier}
+}
+
+// warn about rule labels that aren't in the label file
+func (r *router) check(known []string) {
+	if r == nil || len(known) == 0 {
+		return
+	}
+	names := make(map[string]bool)
+	for _, name := range known {
+		names[strings.ToLower(name)] = true
+	}
+	for _, rule := range r.rules {
+		ruleLabels := append([]string(nil), rule.Labels...)
+		for name := range rule.Scores {
+			ruleLabels = append(ruleLabels, name)
+		}
+		for _, name := range ruleLabels {
+			if !names[strings.ToLower(name)] {
+				log.Printf("Rule label %s is not in the label file\n", name)
+			}
+		}
+	}
+}
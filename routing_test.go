@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plord12/trailcameradownload/camera"
+	"github.com/plord12/trailcameradownload/camera/cameratest"
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/notify"
+)
+
+func TestRules(t *testing.T) {
+
+	rules := []rule{
+		{Labels: []string{"Red_Fox", "Common_Hedgehog"}, Targets: []string{"family"}},
+		{Labels: []string{"Wood_Pigeon"}, Action: actionArchive},
+		{Labels: []string{"Person"}, Scores: map[string]float64{"Person": 0.5}, Targets: []string{"security", "camera"}, Priority: "high"},
+		{Nothing: true, Action: actionDrop},
+	}
+	targets := map[string]map[string]interface{}{
+		"family":   {"signalgroup": "family"},
+		"security": {"signalrecipient": "+441"},
+	}
+	cameraNotifier := &recordingNotifier{}
+	opts := &options{signalUser: "+440", signalRecipient: "+449", emailTo: "camera@example.com", smtpAddr: "localhost:25", notifier: cameraNotifier}
+
+	r, err := newRouter(rules, targets, opts)
+	if err != nil {
+		t.Fatalf("failed to create router - %v", err)
+	}
+
+	// targets keep accounts but not the camera's destinations
+	//
+	family := r.route([]detection.Label{{Name: "Common_Hedgehog", Score: 0.8}}, cameraNotifier)
+	multi, ok := family.notifier.(notify.Multi)
+	if family.action != actionNotify || !ok || len(multi) != 1 {
+		t.Fatalf("unexpected family route %+v", family)
+	}
+	signal, ok := multi[0].(notify.Multi)[0].(*notify.Signal)
+	if !ok || len(multi[0].(notify.Multi)) != 1 || signal.User != "+440" || signal.Group != "family" {
+		t.Errorf("unexpected family notifier %+v", multi[0])
+	}
+
+	if to := r.route([]detection.Label{{Name: "Wood_Pigeon", Score: 0.3}}, cameraNotifier); to.action != actionArchive {
+		t.Errorf("expected archive, got %+v", to)
+	}
+
+	person := r.route([]detection.Label{{Name: "Person", Score: 0.6}}, cameraNotifier)
+	if person.severity != notify.Critical || len(person.notifier.(notify.Multi)) != 2 || person.notifier.(notify.Multi)[1] != cameraNotifier {
+		t.Errorf("unexpected person route %+v", person)
+	}
+
+	// low scores count as nothing
+	//
+	for _, labels := range [][]detection.Label{nil, {{Name: "Red_Fox", Score: 0.01}}} {
+		if to := r.route(labels, cameraNotifier); to.action != actionDrop {
+			t.Errorf("expected drop for %v, got %+v", labels, to)
+		}
+	}
+
+	// the camera's cut-off is the default minscore
+	//
+	cutoffOpts := *opts
+	cutoffOpts.detect.cutoff = 0.5
+	raised, _ := newRouter(rules, targets, &cutoffOpts)
+	if to := raised.route([]detection.Label{{Name: "Red_Fox", Score: 0.4}}, cameraNotifier); to.action != actionDrop {
+		t.Errorf("expected drop below the cut-off, got %+v", to)
+	}
+
+	// no rule matches
+	//
+	rules = rules[:3]
+	r, _ = newRouter(rules, targets, opts)
+	if to := r.route([]detection.Label{{Name: "Domestic_Cat", Score: 0.9}}, cameraNotifier); to.action != actionNotify || to.notifier != cameraNotifier {
+		t.Errorf("expected camera notifier, got %+v", to)
+	}
+	var none *router
+	if to := none.route(nil, cameraNotifier); to.action != actionNotify || to.notifier != cameraNotifier {
+		t.Errorf("expected camera notifier without rules, got %+v", to)
+	}
+
+	for _, bad := range []rule{{Action: "delete"}, {Priority: "urgent"}, {Targets: []string{"missing"}}} {
+		if _, err = newRouter([]rule{bad}, targets, opts); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+	if _, err = newRouter(rules, map[string]map[string]interface{}{"bad": {"address": "x"}}, opts); err == nil {
+		t.Errorf("expected error for target with camera setting")
+	}
+}
+
+func TestRoutedPipeline(t *testing.T) {
+
+	server := cameratest.NewServer()
+	defer server.Close()
+
+	now := time.Now()
+	server.AddPhoto("IM_00001.JPG", []byte("photo"), now)
+	server.AddPhoto("IM_00002.JPG", []byte("photo"), now.Add(time.Minute))
+	server.AddPhoto("IM_00003.JPG", []byte("photo"), now.Add(2*time.Minute))
+
+	client := camera.NewClient(server.Hostname())
+	files, err := listFiles(client)
+	if err != nil {
+		t.Fatalf("failed to list files - %v", err)
+	}
+	picture := func(i int, result *detection.Result) []Picture {
+		return []Picture{{fileName: files[i].FPath, timeStamp: files[i].Time, file: files[i], result: result}}
+	}
+
+	// nothing detected, so archive one and drop the other
+	//
+	notifier := &recordingNotifier{}
+	archived := t.TempDir()
+	stages := cameraStages(client, false, nil, notifier)
+	stages.archive = archived
+	stages.router, err = newRouter([]rule{{Nothing: true, Action: actionArchive}}, nil, &options{notifier: notifier})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := 5
+	runPipeline(context.Background(), picture(0, &detection.Result{}), pipelineConfig{queue: 1}, stages, &limits)
+
+	stages.router, _ = newRouter([]rule{{Nothing: true, Action: actionDrop}}, nil, &options{notifier: notifier})
+	runPipeline(context.Background(), picture(1, &detection.Result{}), pipelineConfig{queue: 1}, stages, &limits)
+
+	if len(notifier.messages) != 0 {
+		t.Errorf("unexpected messages %v", notifier.messages)
+	}
+	copies, _ := filepath.Glob(filepath.Join(archived, "*.jpg"))
+	if len(copies) != 1 {
+		t.Fatalf("expected 1 archived file, got %v", copies)
+	}
+	if data, _ := os.ReadFile(copies[0]); string(data) != "photo" {
+		t.Errorf("unexpected archived data %q", data)
+	}
+
+	// without detection the file is sent rather than dropped unseen
+	//
+	runPipeline(context.Background(), picture(2, nil), pipelineConfig{queue: 1}, stages, &limits)
+
+	if len(notifier.messages) != 1 || len(notifier.messages[0].Attachments) != 1 {
+		t.Fatalf("expected the undetected file to be sent, got %v", notifier.messages)
+	}
+	if len(server.Files()) != 0 {
+		t.Errorf("files left on camera %v", server.Files())
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/montage"
+)
+
+// contact sheet sizes, the test sheet matches the old ImageMagick montage
+var (
+	digestSheet = montage.Sheet{Columns: 3, Width: 512, Spacing: 2}
+	testSheet   = montage.Sheet{Columns: 4, Width: 1024, Spacing: 2}
+)
+
+// most tiles on a digest contact sheet
+const maxSheetTiles = 12
+
+// caption lines for a detection - species scoring over cutoff, then the time
+// taken
+func caption(result *detection.Result, timeStamp string, cutoff float64) []string {
+	var species []string
+	for _, label := range result.Labels {
+		if label.Score > cutoff {
+			species = append(species, fmt.Sprintf("%s %0.1f%%", strings.Replace(label.Name, "_", " ", -1), label.Score*100))
+		}
+	}
+	if len(species) == 0 {
+		species = append(species, "nothing detected")
+	}
+	return []string{strings.Join(species, ", "), timeStamp}
+}
+
+// tile for an annotated image or the best frame of a video, false for videos
+// without one
+func sheetTile(result *detection.Result, timeStamp string, cutoff float64) (montage.Tile, bool) {
+	fileName := result.Output
+	if len(result.Still) > 0 {
+		fileName = result.Still
+	}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return montage.Tile{}, false
+	}
+	img, err := montage.Load(fileName)
+	if err != nil {
+		return montage.Tile{}, false
+	}
+	return montage.Tile{Image: img, Caption: caption(result, timeStamp, cutoff)}, true
+}
+
+// write a contact sheet of tiles to a temporary file, returning its name
+func writeSheet(sheet montage.Sheet, tiles []montage.Tile) (string, error) {
+	img, err := sheet.Draw(tiles)
+	if err != nil {
+		return "", err
+	}
+	tmpFile, err := ioutil.TempFile("", "montage.*.jpg")
+	if err != nil {
+		return "", err
+	}
+	tmpFile.Close()
+	err = montage.WriteJPEG(tmpFile.Name(), img)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", errors.New("unable to write montage - " + err.Error())
+	}
+	return tmpFile.Name(), nil
+}
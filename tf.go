@@ -12,52 +12,86 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 
 	"github.com/mattn/go-tflite"
+	"github.com/plord12/trailcameradownload/detection"
+	"github.com/plord12/trailcameradownload/preview"
 	"github.com/plord12/trailcameradownload/xnnpackbuiltin"
 	"gocv.io/x/gocv"
-
-	"golang.org/x/image/colornames"
 )
 
 var labels []string = nil
+var labelThresholds map[string]float64 = nil
 var model *tflite.Model = nil
 var enableXnnpack bool = false
 
 type ssdResult struct {
-	loc   []float32
-	clazz []float32
-	score []float32
-	mat   gocv.Mat
+	loc    []float32
+	clazz  []float32
+	score  []float32
+	mat    gocv.Mat
+	static bool
+}
+
+// width frames are scaled to for background subtraction
+const motionWidth = 320
+
+// background subtraction, finding the moving part of each frame
+type motionFilter struct {
+	mog2   gocv.BackgroundSubtractorMOG2
+	kernel gocv.Mat
+	frames int
 }
 
 type ssdClass struct {
 	loc   []float32
 	score float64
-	index int
+	label string
+}
+
+// bounding box, loc being top, left, bottom, right
+func (c ssdClass) box() detection.Box {
+	return detection.Box{
+		Left:   float64(c.loc[1]),
+		Top:    float64(c.loc[0]),
+		Right:  float64(c.loc[3]),
+		Bottom: float64(c.loc[2]),
+	}
 }
 
 type result interface {
 	Image() image.Image
 }
 
-func loadLabels(filename string) ([]string, error) {
+// labels, with any thresholds given after them if withThresholds is set
+//
+// classifier labels don't have thresholds, so a label ending in a number is
+// left whole
+func loadLabels(filename string, withThresholds bool) ([]string, map[string]float64, error) {
 	labels := []string{}
+	thresholds := make(map[string]float64)
 	f, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer f.Close()
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		labels = append(labels, scanner.Text())
+		if !withThresholds {
+			labels = append(labels, strings.TrimSpace(scanner.Text()))
+			continue
+		}
+		label, threshold := detection.ParseLabel(scanner.Text())
+		if threshold > 0 {
+			thresholds[label] = threshold
+		}
+		labels = append(labels, label)
 	}
-	return labels, nil
+	return labels, thresholds, nil
 }
 
 func copySlice(f []float32) []float32 {
@@ -99,6 +133,12 @@ func detect(ctx context.Context, wg *sync.WaitGroup, resultChan chan<- *ssdResul
 		qp.Scale = 1
 	}
 
+	var motion *motionFilter
+	if detectSettings.motion.enabled {
+		motion = newMotionFilter()
+		defer motion.close()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -116,9 +156,28 @@ func detect(ctx context.Context, wg *sync.WaitGroup, resultChan chan<- *ssdResul
 			break
 		}
 
+		// skip frames without motion, or just look at the moving part
+		//
+		size := image.Pt(frame.Cols(), frame.Rows())
+		region := image.Rectangle{Max: size}
+		if motion != nil {
+			moving, ok := motion.moving(frame, detectSettings.motion.area)
+			if !ok {
+				resultChan <- &ssdResult{mat: frame, static: true}
+				continue
+			}
+			if detectSettings.motion.crop {
+				region = detectRegion(moving, region, wanted_width)
+			}
+		}
+		detectFrame := frame
+		if region.Size() != size {
+			detectFrame = frame.Region(region)
+		}
+
 		resized := gocv.NewMat()
 		if input.Type() == tflite.Float32 {
-			frame.ConvertTo(&resized, gocv.MatTypeCV32F)
+			detectFrame.ConvertTo(&resized, gocv.MatTypeCV32F)
 			gocv.Resize(resized, &resized, image.Pt(wanted_width, wanted_height), 0, 0, gocv.InterpolationDefault)
 			if ff, err := resized.DataPtrFloat32(); err == nil {
 				for i := 0; i < len(ff); i++ {
@@ -127,21 +186,25 @@ func detect(ctx context.Context, wg *sync.WaitGroup, resultChan chan<- *ssdResul
 				copy(input.Float32s(), ff)
 			}
 		} else {
-			gocv.Resize(frame, &resized, image.Pt(wanted_width, wanted_height), 0, 0, gocv.InterpolationDefault)
+			gocv.Resize(detectFrame, &resized, image.Pt(wanted_width, wanted_height), 0, 0, gocv.InterpolationDefault)
 			if v, err := resized.DataPtrUint8(); err == nil {
 				copy(input.UInt8s(), v)
 			}
 		}
 		resized.Close()
+		if region.Size() != size {
+			detectFrame.Close()
+		}
 		status := interpreter.Invoke()
 		if status != tflite.OK {
 			log.Printf("invoke failed %s\n", status.String())
 			return
 		}
 
+		var result *ssdResult
 		if len(interpreter.GetOutputTensor(0).Float32s()) > len(interpreter.GetOutputTensor(1).Float32s()) {
 			// old style
-			resultChan <- &ssdResult{
+			result = &ssdResult{
 				loc:   copySlice(interpreter.GetOutputTensor(0).Float32s()),
 				clazz: copySlice(interpreter.GetOutputTensor(1).Float32s()),
 				score: copySlice(interpreter.GetOutputTensor(2).Float32s()),
@@ -149,31 +212,97 @@ func detect(ctx context.Context, wg *sync.WaitGroup, resultChan chan<- *ssdResul
 			}
 		} else {
 			// new style
-			resultChan <- &ssdResult{
+			result = &ssdResult{
 				loc:   copySlice(interpreter.GetOutputTensor(1).Float32s()),
 				clazz: copySlice(interpreter.GetOutputTensor(3).Float32s()),
 				score: copySlice(interpreter.GetOutputTensor(0).Float32s()),
 				mat:   frame,
 			}
 		}
+		if region.Size() != size {
+			result.loc = frameLocs(result.loc, region, size)
+		}
+		resultChan <- result
+
+	}
+}
 
+func newMotionFilter() *motionFilter {
+	return &motionFilter{
+		mog2:   gocv.NewBackgroundSubtractorMOG2WithParams(500, 16, true),
+		kernel: gocv.GetStructuringElement(gocv.MorphRect, image.Pt(3, 3)),
 	}
 }
 
+func (m *motionFilter) close() {
+	m.mog2.Close()
+	m.kernel.Close()
+}
+
+// moving part of frame, false if less than area of it moved
+//
+// frames are scaled down first for speed, the first frame is all moving
+func (m *motionFilter) moving(frame gocv.Mat, area float64) (image.Rectangle, bool) {
+
+	full := image.Rect(0, 0, frame.Cols(), frame.Rows())
+	scale := 1.0
+	small := gocv.NewMat()
+	defer small.Close()
+	if frame.Cols() > motionWidth {
+		scale = float64(frame.Cols()) / motionWidth
+		gocv.Resize(frame, &small, image.Pt(motionWidth, int(float64(frame.Rows())/scale)), 0, 0, gocv.InterpolationArea)
+	} else {
+		frame.CopyTo(&small)
+	}
+
+	mask := gocv.NewMat()
+	defer mask.Close()
+	m.mog2.Apply(small, &mask)
+	m.frames++
+	if m.frames == 1 {
+		return full, true
+	}
+
+	// ignore shadows and specks
+	//
+	gocv.Threshold(mask, &mask, 200, 255, gocv.ThresholdBinary)
+	gocv.MorphologyEx(mask, &mask, gocv.MorphOpen, m.kernel)
+	if float64(gocv.CountNonZero(mask)) < area*float64(mask.Rows()*mask.Cols()) {
+		return image.Rectangle{}, false
+	}
+
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+	var moving image.Rectangle
+	for i := 0; i < contours.Size(); i++ {
+		moving = moving.Union(gocv.BoundingRect(contours.At(i)))
+	}
+	return image.Rect(
+		int(float64(moving.Min.X)*scale),
+		int(float64(moving.Min.Y)*scale),
+		int(float64(moving.Max.X)*scale),
+		int(float64(moving.Max.Y)*scale),
+	).Intersect(full), true
+}
+
 func loadModel(modelPath *string, labelPath *string, xnnpack *bool) error {
 
-	var err error
+	// nothing is left loaded on failure, rather than the labels of one model
+	// with another
+	//
+	labels, labelThresholds, model = nil, nil, nil
 
-	labels, err = loadLabels(*labelPath)
+	loadedLabels, thresholds, err := loadLabels(*labelPath, true)
 	if err != nil {
 		return err
 	}
 
-	model = tflite.NewModelFromFile(*modelPath)
-	if model == nil {
+	loaded := tflite.NewModelFromFile(*modelPath)
+	if loaded == nil {
 		return errors.New("cannot load model")
 	}
 
+	labels, labelThresholds, model = loadedLabels, thresholds, loaded
 	enableXnnpack = *xnnpack
 
 	log.Printf("Loaded model %s with %s\n", *modelPath, *labelPath)
@@ -181,32 +310,19 @@ func loadModel(modelPath *string, labelPath *string, xnnpack *bool) error {
 	return nil
 }
 
-func bold(original string) string {
-
-	makeBold := func(r rune) rune {
-		switch {
-		case r >= 'A' && r <= 'Z':
-			return r - 'A' + '𝐀'
-		case r >= 'a' && r <= 'z':
-			return r - 'a' + '𝐚'
-		case r >= '0' && r <= '9':
-			return r - '0' + '𝟎'
-		}
-
-		return r
-	}
-	return strings.Map(makeBold, original)
-}
-
-func objectDetect(inputVideo *string, limits *int, testmode bool) (*string, *string, *[]string, error) {
+// find objects in an image or video, writing an annotated copy
+//
+// returns nil if no model is loaded
+func objectDetect(inputVideo *string, limits *int, testmode bool) (*detection.Result, error) {
 
 	if labels == nil || model == nil {
-		return nil, nil, nil, nil
+		return nil, nil
 	}
 
 	var tmpFile *os.File
 
-	if strings.EqualFold(filepath.Ext(*inputVideo), ".JPG") || strings.EqualFold(filepath.Ext(*inputVideo), ".JPEG") {
+	isImage := strings.EqualFold(filepath.Ext(*inputVideo), ".JPG") || strings.EqualFold(filepath.Ext(*inputVideo), ".JPEG")
+	if isImage {
 		tmpFile, _ = ioutil.TempFile("", "detected.*.%01d"+filepath.Ext(*inputVideo))
 	} else {
 		tmpFile, _ = ioutil.TempFile("", "detected.*"+filepath.Ext(*inputVideo))
@@ -219,14 +335,14 @@ func objectDetect(inputVideo *string, limits *int, testmode bool) (*string, *str
 	cam, err := gocv.OpenVideoCapture(*inputVideo)
 	if err != nil {
 		cancel()
-		return nil, nil, nil, errors.New("cannot open input: " + err.Error())
+		return nil, errors.New("cannot open input: " + err.Error())
 	}
 	defer cam.Close()
 
 	vw, err := gocv.VideoWriterFile(outputVideo, cam.CodecString(), cam.Get(gocv.VideoCaptureFPS), int(cam.Get(gocv.VideoCaptureFrameWidth)), int(cam.Get(gocv.VideoCaptureFrameHeight)), true)
 	if err != nil {
 		cancel()
-		return nil, nil, nil, errors.New("cannot open output: " + err.Error())
+		return nil, errors.New("cannot open output: " + err.Error())
 	}
 	defer vw.Close()
 
@@ -242,16 +358,25 @@ func objectDetect(inputVideo *string, limits *int, testmode bool) (*string, *str
 	resultChan := make(chan *ssdResult, 2)
 	go detect(ctx, &wg, resultChan, cam)
 
-	sc := make(chan os.Signal, 1)
-	defer close(sc)
-	signal.Notify(sc, os.Interrupt)
-	go func() {
-		<-sc
-		cancel()
-	}()
+	// preview of the frames with detections
+	//
+	var clip *preview.Builder
+	if len(detectSettings.preview.Format) > 0 && !isImage {
+		clip = preview.NewBuilder(detectSettings.preview, cam.Get(gocv.VideoCaptureFPS))
+	}
 
-	objects := make(map[string]float64)
+	refine := newClassifier()
+	defer refine.close()
+
+	// highest scoring frame of a video
+	//
+	best := gocv.NewMat()
+	defer best.Close()
+	bestScore := 0.0
+
+	var detections []detection.Detection
 	frames := 0
+	static := 0
 
 	for {
 		// Run inference if we have a new frame to read
@@ -263,55 +388,97 @@ func objectDetect(inputVideo *string, limits *int, testmode bool) (*string, *str
 		if testmode {
 			log.Printf("TESTMODE: Processing %s %d\n", *inputVideo, frames)
 		}
+		if result.static {
+			static++
+		}
 		classes := make([]ssdClass, 0, len(result.clazz))
 		for i := 0; i < len(result.clazz); i++ {
 			idx := int(result.clazz[i]) // was +1
 			if idx < 0 {
 				continue
 			}
+			label := "unknown"
+			if idx < len(labels) {
+				label = labels[idx]
+			}
 			if testmode {
-				log.Printf("TESTMODE: Found label %d (%s) at %v with score %f\n", idx, labels[idx], result.loc[i*4:(i+1)*4], result.score[i])
+				log.Printf("TESTMODE: Found label %d (%s) at %v with score %f\n", idx, label, result.loc[i*4:(i+1)*4], result.score[i])
 			}
 			score := float64(result.score[i])
-			if score < 0.6 {
+			if score < detectSettings.scoreThreshold(label) {
 				continue
 			}
-			classes = append(classes, ssdClass{loc: result.loc[i*4 : (i+1)*4], score: score, index: idx})
+			classes = append(classes, ssdClass{loc: result.loc[i*4 : (i+1)*4], score: score, label: label})
+		}
+
+		// drop boxes overlapping better ones, highest score first
+		//
+		candidates := make([]detection.Detection, len(classes))
+		for i, class := range classes {
+			candidates[i] = detection.Detection{Label: class.label, Score: class.score, Box: class.box()}
+		}
+		kept := make([]ssdClass, 0, len(classes))
+		for _, i := range detectSettings.suppression.Keep(candidates) {
+			kept = append(kept, classes[i])
 		}
-		sort.Slice(classes, func(i, j int) bool {
-			return classes[i].score > classes[j].score
-		})
+		classes = kept
 		if len(classes) > *limits {
 			classes = classes[:*limits]
 		}
 
+		// refine labels with the second stage classifier when it's confident
+		//
+		if refine != nil {
+			for i := range classes {
+				if !detectSettings.classifies(classes[i].label) {
+					continue
+				}
+				label, score := refine.classify(result.mat, classes[i].loc)
+				if testmode {
+					log.Printf("TESTMODE: Classified %s as %s with score %f\n", classes[i].label, label, score)
+				}
+				classes[i].label, classes[i].score = detectSettings.refine(classes[i].label, classes[i].score, label, score)
+			}
+
+			// refined scores may change the order
+			//
+			sort.SliceStable(classes, func(i, j int) bool {
+				return classes[i].score > classes[j].score
+			})
+		}
+
 		size := result.mat.Size()
 		for _, class := range classes {
-			label := "unknown"
-			if class.index < len(labels) {
-				label = labels[class.index]
-			}
-			c := colornames.Map[colornames.Names[class.index%len(colornames.Names)]]
+			c := labelColour(class.label)
 			gocv.Rectangle(&result.mat, image.Rect(
 				int(float32(size[1])*class.loc[1]),
 				int(float32(size[0])*class.loc[0]),
 				int(float32(size[1])*class.loc[3]),
 				int(float32(size[0])*class.loc[2]),
 			), c, rectangleWidth)
-			text := fmt.Sprintf("%s: %.1f%%", strings.Replace(label, "_", " ", -1), class.score*100)
+			text := fmt.Sprintf("%s: %.1f%%", strings.Replace(class.label, "_", " ", -1), class.score*100)
 			textlocation := image.Pt(int(float32(size[1])*class.loc[1]), int(float32(size[0])*class.loc[0]))
 			textsize := gocv.GetTextSize(text, gocv.FontHersheySimplex, fontScale, fontThickness)
 			gocv.Rectangle(&result.mat, image.Rect(textlocation.X, textlocation.Y, textlocation.X+textsize.X, textlocation.Y-textsize.Y), color.RGBA{0, 0, 0, 0}, -1)
 			gocv.PutText(&result.mat, text, textlocation, gocv.FontHersheySimplex, fontScale, color.RGBA{255, 255, 255, 0}, fontThickness)
 
-			_, exists := objects[label]
-			if exists {
-				objects[label] = objects[label] + class.score
-			} else {
-				objects[label] = class.score
+			detections = append(detections, detection.Detection{
+				Label: class.label,
+				Score: class.score,
+				Box:   class.box(),
+				Frame: frames,
+			})
+		}
+		if !isImage && len(classes) > 0 && classes[0].score > bestScore {
+			result.mat.CopyTo(&best)
+			bestScore = classes[0].score
+		}
+		if clip != nil && len(classes) > 0 && clip.Wants(frames) {
+			if img, err := result.mat.ToImage(); err == nil {
+				clip.Add(frames, img)
 			}
-			frames++
 		}
+		frames++
 
 		vw.Write(result.mat)
 		result.mat.Close()
@@ -320,30 +487,20 @@ func objectDetect(inputVideo *string, limits *int, testmode bool) (*string, *str
 	cancel()
 	wg.Wait()
 
-	keys := make([]string, 0, len(objects))
-	for key := range objects {
-		keys = append(keys, key)
-	}
-	sort.SliceStable(keys, func(i, j int) bool {
-		return objects[keys[i]] > objects[keys[j]]
-	})
-
-	description := ""
-	first := true
-	for _, name := range keys {
-		averageScore := objects[name] * 100.0 / float64(frames)
-		log.Printf("%s (%0.1f%%)\n", name, averageScore)
-		if averageScore > 5 {
-			if first {
-				description = fmt.Sprintf("%s %s (%0.1f%%)", description, bold(strings.Replace(name, "_", " ", -1)), averageScore)
-			} else {
-				description = fmt.Sprintf("%s %s (%0.1f%%)", description, strings.Replace(name, "_", " ", -1), averageScore)
-			}
-			first = false
-		}
+	if static > 0 {
+		log.Printf("Skipped %d of %d frames without motion\n", static, frames)
+	}
+
+	// follow objects across frames rather than adding up every box
+	//
+	fps := cam.Get(gocv.VideoCaptureFPS)
+	tracks := detection.DefaultTracking.Tracks(detections, frames, fps)
+	labelScores := detection.Summarise(tracks, frames, fps)
+	for _, label := range labelScores {
+		log.Printf("%d × %s (%0.1f%%)\n", label.Count, label.Name, label.Score*100)
 	}
 
-	if strings.EqualFold(filepath.Ext(*inputVideo), ".JPG") || strings.EqualFold(filepath.Ext(*inputVideo), ".JPEG") {
+	if isImage {
 		for i := 0; i < 10; i++ {
 			formatedFile := fmt.Sprintf(outputVideo, i)
 			if _, err := os.Stat(formatedFile); errors.Is(err, os.ErrNotExist) {
@@ -354,5 +511,157 @@ func objectDetect(inputVideo *string, limits *int, testmode bool) (*string, *str
 			break
 		}
 	}
-	return &outputVideo, &description, &keys, nil
+
+	previewFile := ""
+	if clip != nil && clip.Len() > 0 {
+		previewFile = writePreview(clip, detectSettings.preview.Format)
+	}
+
+	// cut videos down to the parts with detections
+	//
+	trimmedFile := ""
+	if !isImage && len(detectSettings.trim) > 0 {
+		segments := detection.Segments(detections, frames, fps, detectSettings.trimPadding)
+		if len(segments) > 1 || (len(segments) == 1 && segments[0].End-segments[0].Start < frames) {
+			vw.Close()
+			if detectSettings.trim != trimOriginal {
+				annotated, err := trimVideo(outputVideo, segments)
+				if err != nil {
+					log.Println(err.Error())
+				} else {
+					os.Remove(outputVideo)
+					outputVideo = annotated
+				}
+			}
+			if detectSettings.trim != trimAnnotated {
+				trimmedFile, err = trimVideo(*inputVideo, segments)
+				if err != nil {
+					log.Println(err.Error())
+				}
+			}
+		}
+	}
+
+	stillFile := ""
+	if bestScore > 0 {
+		stillFile = writeStill(best)
+	}
+
+	return &detection.Result{
+		Output:      outputVideo,
+		Preview:     previewFile,
+		Still:       stillFile,
+		Trimmed:     trimmedFile,
+		Description: detection.Describe(labelScores, detectSettings.labelCutoff()),
+		Labels:      labelScores,
+		Detections:  detections,
+		Tracks:      tracks,
+		Frames:      frames,
+	}, nil
+}
+
+// copy the frames of a video in segments to a temporary file, returning its
+// name
+func trimVideo(inputVideo string, segments []detection.Segment) (string, error) {
+
+	cam, err := gocv.OpenVideoCapture(inputVideo)
+	if err != nil {
+		return "", errors.New("cannot open input: " + err.Error())
+	}
+	defer cam.Close()
+
+	tmpFile, err := ioutil.TempFile("", "trimmed.*"+filepath.Ext(inputVideo))
+	if err != nil {
+		return "", err
+	}
+	tmpFile.Close()
+
+	vw, err := gocv.VideoWriterFile(tmpFile.Name(), cam.CodecString(), cam.Get(gocv.VideoCaptureFPS), int(cam.Get(gocv.VideoCaptureFrameWidth)), int(cam.Get(gocv.VideoCaptureFrameHeight)), true)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", errors.New("cannot open output: " + err.Error())
+	}
+	defer vw.Close()
+
+	frame := gocv.NewMat()
+	defer frame.Close()
+	segment := 0
+	for i := 0; cam.Read(&frame); i++ {
+		for segment < len(segments) && i >= segments[segment].End {
+			segment++
+		}
+		if segment == len(segments) {
+			break
+		}
+		if i >= segments[segment].Start {
+			vw.Write(frame)
+		}
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// write a frame to a temporary JPEG, returning its name or "" if it failed
+func writeStill(frame gocv.Mat) string {
+
+	tmpFile, err := ioutil.TempFile("", "still.*.jpg")
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+	tmpFile.Close()
+
+	if !gocv.IMWrite(tmpFile.Name(), frame) {
+		log.Printf("unable to write %s\n", tmpFile.Name())
+		os.Remove(tmpFile.Name())
+		return ""
+	}
+	return tmpFile.Name()
+}
+
+// write a preview to a temporary file, returning its name or "" if it failed
+func writePreview(clip *preview.Builder, format string) string {
+
+	tmpFile, err := ioutil.TempFile("", "preview.*."+format)
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+	tmpFile.Close()
+
+	encode := preview.EncodeGIF
+	if format == preview.MP4 {
+		encode = encodeMP4
+	}
+	err = clip.Write(tmpFile.Name(), encode)
+	if err != nil {
+		log.Println(err.Error())
+		os.Remove(tmpFile.Name())
+		return ""
+	}
+	return tmpFile.Name()
+}
+
+// write frames as an H.264 MP4
+func encodeMP4(fileName string, frames []image.Image, fps float64) error {
+
+	bounds := frames[0].Bounds()
+	vw, err := gocv.VideoWriterFile(fileName, "avc1", fps, bounds.Dx(), bounds.Dy(), true)
+	if err != nil {
+		return err
+	}
+	defer vw.Close()
+
+	for _, frame := range frames {
+		mat, err := gocv.ImageToMatRGB(frame)
+		if err != nil {
+			return err
+		}
+		err = vw.Write(mat)
+		mat.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -45,14 +45,14 @@ func TestTF(t *testing.T) {
 
 	for _, animal := range animals {
 		picture := "testdata/" + animal + ".jpg"
-		outputfileName, _, names, err := objectDetect(&picture, &limits, true)
+		result, err := objectDetect(&picture, &limits, true)
 		if err != nil {
 			t.Errorf("%s: object detect failed - %v", animal, err)
 		}
-		if (*names)[0] != animal {
-			t.Errorf("%s: didn't match - see %s", animal, *outputfileName)
+		if result.Names()[0] != animal {
+			t.Errorf("%s: didn't match - see %s", animal, result.Output)
 		} else {
-			log.Printf("%s: Output image at %s\n", animal, *outputfileName)
+			log.Printf("%s: Output image at %s\n", animal, result.Output)
 		}
 	}
 